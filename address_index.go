@@ -0,0 +1,196 @@
+package main
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/hex"
+	"log"
+)
+
+const addrIndexBucket = "addrindex"
+
+// 地址索引记录主链上每个地址的收款和付款事件。
+// key为 公钥Hash的长度+公钥Hash+区块高度+交易Hash+事件类型+输出或输入索引，所以同一个地址的事件按高度顺序排列。
+// 公钥Hash前面加上长度，一个公钥Hash是另一个的前缀时两者的事件也不会混在一起。
+// 区块连接到主链时加入索引，从主链断开时删除
+
+const (
+	addrEventFunding  byte = 0 //收款：交易的输出锁定到该地址
+	addrEventSpending byte = 1 //付款：交易的输入花费了该地址的输出
+)
+
+// AddressEvent 一个地址的一次收款或付款
+type AddressEvent struct {
+	Txid     []byte //交易Hash
+	Height   int    //交易所在区块的高度
+	Index    int    //收款时为输出索引，付款时为输入索引
+	Value    int    //金额
+	Spending bool   //是否为付款
+}
+
+// Serialize serializes the address event
+func (e AddressEvent) Serialize() []byte {
+	var result bytes.Buffer
+	encoder := gob.NewEncoder(&result)
+
+	err := encoder.Encode(e)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	return result.Bytes()
+}
+
+// DeserializeAddressEvent deserializes an address event
+func DeserializeAddressEvent(d []byte) AddressEvent {
+	var e AddressEvent
+
+	decoder := gob.NewDecoder(bytes.NewReader(d))
+	err := decoder.Decode(&e)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	return e
+}
+
+// addrKeyPrefix 返回一个地址所有事件key的公共前缀
+func addrKeyPrefix(pubKeyHash []byte) []byte {
+	return append([]byte{byte(len(pubKeyHash))}, pubKeyHash...)
+}
+
+// addrEventKey 生成地址事件的key
+func addrEventKey(pubKeyHash []byte, e AddressEvent) []byte {
+	kind := addrEventFunding
+	if e.Spending {
+		kind = addrEventSpending
+	}
+
+	key := addrKeyPrefix(pubKeyHash)
+	key = append(key, IntToHex(int64(e.Height))...)
+	key = append(key, e.Txid...)
+	key = append(key, kind)
+	key = append(key, IntToHex(int64(e.Index))...)
+
+	return key
+}
+
+// addressEvents 列出区块中的所有地址事件，spent是区块按顺序花费的输出（撤销数据）。
+// 回调函数的参数是事件所属地址的公钥Hash
+func addressEvents(block *Block, spent []SpentOutput, fn func(pubKeyHash []byte, e AddressEvent)) {
+	pos := 0
+
+	for _, transaction := range block.Transactions {
+		if !transaction.IsCoinbase() {
+			for inIdx := range transaction.Vin {
+				out := spent[pos].Output
+				pos++
+				fn(out.PubKeyHash, AddressEvent{transaction.ID, block.Height, inIdx, out.Value, true})
+			}
+		}
+
+		for outIdx, out := range transaction.Vout {
+			fn(out.PubKeyHash, AddressEvent{transaction.ID, block.Height, outIdx, out.Value, false})
+		}
+	}
+}
+
+// indexBlockAddresses 在事务内把区块的地址事件加入地址索引
+func indexBlockAddresses(tx StorageTx, block *Block, undo BlockUndo) {
+	b := tx.Bucket([]byte(addrIndexBucket))
+
+	addressEvents(block, undo.Spent, func(pubKeyHash []byte, e AddressEvent) {
+		err := b.Put(addrEventKey(pubKeyHash, e), e.Serialize())
+		if err != nil {
+			log.Panic(err)
+		}
+	})
+}
+
+// unindexBlockAddresses 在事务内从地址索引中删除区块的地址事件
+func unindexBlockAddresses(tx StorageTx, block *Block, undo BlockUndo) {
+	b := tx.Bucket([]byte(addrIndexBucket))
+
+	addressEvents(block, undo.Spent, func(pubKeyHash []byte, e AddressEvent) {
+		err := b.Delete(addrEventKey(pubKeyHash, e))
+		if err != nil {
+			log.Panic(err)
+		}
+	})
+}
+
+// indexAddresses 在事务内为从创世区块到tip的主链区块重建地址索引，
+// 按高度顺序处理区块，被花费的输出从前面处理过的交易中查找
+func indexAddresses(tx StorageTx, tip []byte) {
+	var blocks []*Block
+	b := tx.Bucket([]byte(blocksBucket))
+
+	err := tx.DeleteBucket([]byte(addrIndexBucket))
+	if err != nil && err != ErrBucketNotFound {
+		log.Panic(err)
+	}
+	_, err = tx.CreateBucket([]byte(addrIndexBucket))
+	if err != nil {
+		log.Panic(err)
+	}
+
+	for hash := tip; len(hash) > 0; {
+		block := DeserializeBlock(b.Get(hash))
+		blocks = append(blocks, block)
+		hash = block.PrevBlockHash
+	}
+
+	outputs := make(map[string][]TXOutput)
+	for i := len(blocks) - 1; i >= 0; i-- {
+		block := blocks[i]
+		undo := BlockUndo{}
+
+		for _, transaction := range block.Transactions {
+			if !transaction.IsCoinbase() {
+				for _, vin := range transaction.Vin {
+					out := outputs[hex.EncodeToString(vin.Txid)][vin.Vout]
+					undo.Spent = append(undo.Spent, SpentOutput{vin.Txid, vin.Vout, out, 0, false})
+				}
+			}
+			outputs[hex.EncodeToString(transaction.ID)] = transaction.Vout
+		}
+
+		indexBlockAddresses(tx, block, undo)
+	}
+}
+
+// GetAddressHistory returns all funding and spending events of the address, ordered by height
+func (bc *Blockchain) GetAddressHistory(pubKeyHash []byte) []AddressEvent {
+	var events []AddressEvent
+
+	err := bc.db.View(func(tx StorageTx) error {
+		c := tx.Bucket([]byte(addrIndexBucket)).Cursor()
+		prefix := addrKeyPrefix(pubKeyHash)
+
+		for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+			events = append(events, DeserializeAddressEvent(v))
+		}
+
+		return nil
+	})
+	if err != nil {
+		log.Panic(err)
+	}
+
+	return events
+}
+
+// GetAddressBalance returns the balance of the address computed from the address index
+func (bc *Blockchain) GetAddressBalance(pubKeyHash []byte) int {
+	balance := 0
+
+	for _, e := range bc.GetAddressHistory(pubKeyHash) {
+		if e.Spending {
+			balance -= e.Value
+		} else {
+			balance += e.Value
+		}
+	}
+
+	return balance
+}
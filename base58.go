@@ -2,11 +2,24 @@ package main
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
 	"math/big"
 )
 
 var b58Alphabet = []byte("123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz")
 
+// checksumLen Base58Check校验和的字节数
+const checksumLen = 4
+
+var (
+	// ErrChecksumMismatch 表示Base58Check数据的校验和不正确
+	ErrChecksumMismatch = errors.New("base58check checksum mismatch")
+	// ErrInvalidLength 表示Base58Check数据太短，放不下版本号和校验和
+	ErrInvalidLength = errors.New("base58check data is too short")
+)
+
 // 将字节数组编码为Base58
 func Base58Encode(input []byte) []byte {
 	var result []byte
@@ -23,7 +36,7 @@ func Base58Encode(input []byte) []byte {
 	}
 
 	ReverseBytes(result)
-	for b := range input {
+	for _, b := range input {
 		if b == 0x00 {
 			result = append([]byte{b58Alphabet[0]}, result...)
 		} else {
@@ -34,20 +47,25 @@ func Base58Encode(input []byte) []byte {
 	return result
 }
 
-// 解码Base58编码后的数据
-func Base58Decode(input []byte) []byte {
+// 解码Base58编码后的数据，遇到不在字母表中的字符时返回错误
+func Base58Decode(input []byte) ([]byte, error) {
 	result := big.NewInt(0)
 	zeroBytes := 0
 
-	for b := range input {
-		if b == 0x00 {
+	for _, b := range input {
+		if b == b58Alphabet[0] {
 			zeroBytes++
+		} else {
+			break
 		}
 	}
 
 	payload := input[zeroBytes:]
-	for _, b := range payload {
+	for i, b := range payload {
 		charIndex := bytes.IndexByte(b58Alphabet, b)
+		if charIndex < 0 {
+			return nil, fmt.Errorf("invalid base58 character %q at position %d", b, zeroBytes+i)
+		}
 		result.Mul(result, big.NewInt(58))
 		result.Add(result, big.NewInt(int64(charIndex)))
 	}
@@ -55,5 +73,38 @@ func Base58Decode(input []byte) []byte {
 	decoded := result.Bytes()
 	decoded = append(bytes.Repeat([]byte{byte(0x00)}, zeroBytes), decoded...)
 
-	return decoded
+	return decoded, nil
+}
+
+// Base58CheckEncode 编码 版本号 + payload + 校验和，校验和是前面数据两次SHA-256的前4个字节
+func Base58CheckEncode(version byte, payload []byte) []byte {
+	versionedPayload := append([]byte{version}, payload...)
+
+	return Base58Encode(append(versionedPayload, checksum(versionedPayload)...))
+}
+
+// Base58CheckDecode 解码Base58Check数据并检查校验和，返回版本号和payload
+func Base58CheckDecode(input []byte) (byte, []byte, error) {
+	decoded, err := Base58Decode(input)
+	if err != nil {
+		return 0, nil, err
+	}
+	if len(decoded) < 1+checksumLen {
+		return 0, nil, ErrInvalidLength
+	}
+
+	versionedPayload := decoded[:len(decoded)-checksumLen]
+	if !bytes.Equal(checksum(versionedPayload), decoded[len(decoded)-checksumLen:]) {
+		return 0, nil, ErrChecksumMismatch
+	}
+
+	return versionedPayload[0], versionedPayload[1:], nil
+}
+
+// checksum returns the first checksumLen bytes of the double SHA-256 of a Base58Check payload (version byte included)
+func checksum(payload []byte) []byte {
+	firstSHA := sha256.Sum256(payload)
+	secondSHA := sha256.Sum256(firstSHA[:])
+
+	return secondSHA[:checksumLen]
 }
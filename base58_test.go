@@ -0,0 +1,73 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBase58(t *testing.T) {
+	cases := map[string]string{
+		"":                  "",
+		"\x00":              "1",
+		"\x00\x00\x01":      "112",
+		"hello world":       "StV1DL6CwTryKyV",
+		"\x00\x00hello\xff": "11tzCkV5HY",
+	}
+
+	for input, encoded := range cases {
+		assert.Equal(t, encoded, string(Base58Encode([]byte(input))))
+
+		decoded, err := Base58Decode([]byte(encoded))
+		assert.Nil(t, err)
+		assert.Equal(t, []byte(input), decoded)
+	}
+
+	_, err := Base58Decode([]byte("1O"))
+	assert.NotNil(t, err)
+}
+
+func TestBase58Check(t *testing.T) {
+	payload := []byte{1, 2, 3, 4}
+	encoded := Base58CheckEncode(0x6f, payload)
+
+	version, decoded, err := Base58CheckDecode(encoded)
+	assert.Nil(t, err)
+	assert.Equal(t, byte(0x6f), version)
+	assert.Equal(t, payload, decoded)
+
+	corrupted := append([]byte{}, encoded...)
+	corrupted[len(corrupted)-1] = b58Alphabet[(indexOf(corrupted[len(corrupted)-1])+1)%58]
+	_, _, err = Base58CheckDecode(corrupted)
+	assert.Equal(t, ErrChecksumMismatch, err)
+
+	_, _, err = Base58CheckDecode([]byte("1111"))
+	assert.Equal(t, ErrInvalidLength, err)
+}
+
+func TestDecodeAddress(t *testing.T) {
+	address := string(NewWallet().GetAddress())
+
+	pubKeyHash, err := DecodeAddress(address)
+	assert.Nil(t, err)
+	assert.Len(t, pubKeyHash, 20)
+
+	//短地址和非法字符返回错误而不是panic
+	for _, bad := range []string{"", "1", "abc", address[:len(address)-1], address + "0"} {
+		assert.False(t, ValidateAddress(bad), bad)
+	}
+
+	defer func(old *ChainParams) { activeNetParams = old }(activeNetParams)
+	activeNetParams = &TestNetParams
+	assert.False(t, ValidateAddress(address))
+}
+
+func indexOf(c byte) int {
+	for i, b := range b58Alphabet {
+		if b == c {
+			return i
+		}
+	}
+
+	return -1
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+)
+
+/**
+Bech32 编码（BIP173）
+地址由 人类可读前缀（HRP）、分隔符"1"、数据部分组成，数据部分的每个字符表示5位，最后6个字符是BCH校验码，
+可以检测出任意不超过4个字符的错误。地址要么全部小写要么全部大写，输出时总是使用小写。
+和比特币的P2WPKH地址一样，数据部分是见证版本0加上20字节的公钥Hash
+*/
+
+const bech32Charset = "qpzry9x8gf2tvdw0s3jn54khce6mua7l"
+
+// bech32MaxLen BIP173规定的地址最大长度
+const bech32MaxLen = 90
+
+// bech32WitnessVersion 地址数据部分的第一个5位数，目前只有版本0
+const bech32WitnessVersion = 0
+
+var bech32Generator = [5]uint32{0x3b6a57b2, 0x26508e6d, 0x1ea119fa, 0x3d4233dd, 0x2a1462b3}
+
+// ErrBech32Checksum 表示Bech32字符串的校验码不正确
+var ErrBech32Checksum = errors.New("bech32 checksum mismatch")
+
+func bech32Polymod(values []byte) uint32 {
+	chk := uint32(1)
+
+	for _, v := range values {
+		top := chk >> 25
+		chk = (chk&0x1ffffff)<<5 ^ uint32(v)
+		for i := 0; i < 5; i++ {
+			if (top>>uint(i))&1 == 1 {
+				chk ^= bech32Generator[i]
+			}
+		}
+	}
+
+	return chk
+}
+
+// bech32HrpExpand 把前缀展开为参与校验码计算的5位数：每个字符的高3位、0、每个字符的低5位
+func bech32HrpExpand(hrp string) []byte {
+	result := make([]byte, 0, len(hrp)*2+1)
+
+	for i := 0; i < len(hrp); i++ {
+		result = append(result, hrp[i]>>5)
+	}
+	result = append(result, 0)
+	for i := 0; i < len(hrp); i++ {
+		result = append(result, hrp[i]&31)
+	}
+
+	return result
+}
+
+func bech32Checksum(hrp string, data []byte) []byte {
+	values := append(bech32HrpExpand(hrp), data...)
+	values = append(values, 0, 0, 0, 0, 0, 0)
+	polymod := bech32Polymod(values) ^ 1
+
+	result := make([]byte, 6)
+	for i := range result {
+		result[i] = byte(polymod>>uint(5*(5-i))) & 31
+	}
+
+	return result
+}
+
+// Bech32Encode 把前缀和5位数组成的数据编码为Bech32字符串
+func Bech32Encode(hrp string, data []byte) (string, error) {
+	if len(hrp) == 0 || len(hrp)+len(data)+7 > bech32MaxLen {
+		return "", errors.New("bech32 string length is out of range")
+	}
+	for i := 0; i < len(hrp); i++ {
+		if hrp[i] < 33 || hrp[i] > 126 || (hrp[i] >= 'A' && hrp[i] <= 'Z') {
+			return "", fmt.Errorf("invalid bech32 prefix character %q", hrp[i])
+		}
+	}
+
+	var sb strings.Builder
+	sb.WriteString(hrp)
+	sb.WriteByte('1')
+	for _, v := range append(data, bech32Checksum(hrp, data)...) {
+		if v > 31 {
+			return "", fmt.Errorf("invalid bech32 data value %d", v)
+		}
+		sb.WriteByte(bech32Charset[v])
+	}
+
+	return sb.String(), nil
+}
+
+// Bech32Decode 解码Bech32字符串并检查校验码，返回小写的前缀和去掉校验码的5位数据
+func Bech32Decode(s string) (string, []byte, error) {
+	if len(s) < 8 || len(s) > bech32MaxLen {
+		return "", nil, errors.New("bech32 string length is out of range")
+	}
+
+	//不允许大小写混用
+	lower := strings.ToLower(s)
+	if s != lower && s != strings.ToUpper(s) {
+		return "", nil, errors.New("bech32 string uses mixed case")
+	}
+	for i := 0; i < len(lower); i++ {
+		if lower[i] < 33 || lower[i] > 126 {
+			return "", nil, fmt.Errorf("invalid bech32 character at position %d", i)
+		}
+	}
+
+	sep := strings.LastIndexByte(lower, '1')
+	if sep < 1 || sep+7 > len(lower) {
+		return "", nil, errors.New("bech32 separator is missing or misplaced")
+	}
+
+	hrp := lower[:sep]
+	var data []byte
+	for i := sep + 1; i < len(lower); i++ {
+		v := strings.IndexByte(bech32Charset, lower[i])
+		if v < 0 {
+			return "", nil, fmt.Errorf("invalid bech32 character %q at position %d", s[i], i)
+		}
+		data = append(data, byte(v))
+	}
+
+	if bech32Polymod(append(bech32HrpExpand(hrp), data...)) != 1 {
+		return "", nil, ErrBech32Checksum
+	}
+
+	return hrp, data[:len(data)-6], nil
+}
+
+// convertBits 在每个元素fromBits位和toBits位的数组之间转换，pad为false时多余的位必须为0
+func convertBits(data []byte, fromBits, toBits uint, pad bool) ([]byte, error) {
+	var result []byte
+	acc := uint32(0)
+	bits := uint(0)
+	maxv := uint32(1)<<toBits - 1
+
+	for _, v := range data {
+		if uint32(v)>>fromBits != 0 {
+			return nil, fmt.Errorf("invalid data value %d", v)
+		}
+		acc = acc<<fromBits | uint32(v)
+		bits += fromBits
+		for bits >= toBits {
+			bits -= toBits
+			result = append(result, byte(acc>>bits&maxv))
+		}
+	}
+
+	if pad {
+		if bits > 0 {
+			result = append(result, byte(acc<<(toBits-bits)&maxv))
+		}
+	} else if bits >= fromBits || acc<<(toBits-bits)&maxv != 0 {
+		return nil, errors.New("invalid padding")
+	}
+
+	return result, nil
+}
+
+// encodeBech32Address 返回公钥Hash在当前网络的Bech32地址
+func encodeBech32Address(pubKeyHash []byte) string {
+	program, err := convertBits(pubKeyHash, 8, 5, true)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	address, err := Bech32Encode(activeNetParams.Bech32HRP, append([]byte{bech32WitnessVersion}, program...))
+	if err != nil {
+		log.Panic(err)
+	}
+
+	return address
+}
+
+// decodeBech32Address 解码Bech32地址中的公钥Hash，前缀必须是当前网络的前缀
+func decodeBech32Address(address string) ([]byte, error) {
+	hrp, data, err := Bech32Decode(address)
+	if err != nil {
+		return nil, err
+	}
+	if hrp != activeNetParams.Bech32HRP {
+		return nil, fmt.Errorf("address prefix %q is not valid on %s", hrp, activeNetParams.Name)
+	}
+	if len(data) < 1 || data[0] != bech32WitnessVersion {
+		return nil, errors.New("unsupported bech32 address version")
+	}
+
+	return convertBits(data[1:], 5, 8, false)
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBech32(t *testing.T) {
+	//BIP173中的有效字符串
+	for _, s := range []string{
+		"A12UEL5L",
+		"a12uel5l",
+		"an83characterlonghumanreadablepartthatcontainsthenumber1andtheexcludedcharactersbio1tt5tgs",
+		"abcdef1qpzry9x8gf2tvdw0s3jn54khce6mua7lmqqqxw",
+		"split1checkupstagehandshakeupstreamerranterredcaperred2y9e3w",
+		"bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4",
+	} {
+		hrp, data, err := Bech32Decode(s)
+		assert.Nil(t, err, s)
+
+		encoded, err := Bech32Encode(hrp, data)
+		assert.Nil(t, err, s)
+		assert.Equal(t, strings.ToLower(s), encoded)
+	}
+
+	//BIP173中的无效字符串
+	for _, s := range []string{
+		"\x201nwldj5",
+		"pzry9x0s0muk",
+		"1pzry9x0s0muk",
+		"x1b4n0q5v",
+		"li1dgmt3",
+		"A1G7SGD8",
+		"10a06t8",
+		"1qzzfhee",
+		"bc1qw508D6qejxtdg4y5r3zarvary0c5xw7kv8f3t4",
+	} {
+		_, _, err := Bech32Decode(s)
+		assert.NotNil(t, err, s)
+	}
+
+	_, _, err := Bech32Decode("bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t5")
+	assert.Equal(t, ErrBech32Checksum, err)
+}
+
+func TestBech32Address(t *testing.T) {
+	wallet := NewWallet()
+	wallet.AddressType = addressTypeBech32
+	address := string(wallet.GetAddress())
+
+	assert.True(t, strings.HasPrefix(address, MainNetParams.Bech32HRP+"1"))
+
+	//Bech32地址和Base58地址对应同一个公钥Hash，地址不区分大小写
+	pubKeyHash, err := DecodeAddress(address)
+	assert.Nil(t, err)
+	assert.Equal(t, HashPubKey(wallet.PublicKey), pubKeyHash)
+	assert.True(t, ValidateAddress(strings.ToUpper(address)))
+
+	//改动一个字符会被校验码发现
+	last := address[len(address)-1]
+	typo := address[:len(address)-1] + string(bech32Charset[(strings.IndexByte(bech32Charset, last)+1)%32])
+	assert.False(t, ValidateAddress(typo))
+
+	defer func(old *ChainParams) { activeNetParams = old }(activeNetParams)
+	activeNetParams = &TestNetParams
+	assert.False(t, ValidateAddress(address))
+}
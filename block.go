@@ -2,36 +2,54 @@ package main
 
 import (
 	"bytes"
-	"encoding/gob"
+	"context"
+	"errors"
 	"log"
+	"math"
 	"time"
 )
 
 // Block represents a block in the blockchain
 type Block struct {
-	Timestamp     int64          //时间戳，也就是区块创建的时间
-	Transactions  []*Transaction //交易列表
-	PrevBlockHash []byte         //上一个区块的Hash值
-	Hash          []byte         //当前区块的Hash值
-	Nonce         int            //计数器，也就是pow做Hash的次数
-	Height        int            //当前区块的高度
+	BlockHeader                 //区块头
+	Transactions []*Transaction //交易列表
+	Hash         []byte         //当前区块的Hash值，也就是区块头的Hash
+	Height       int            //当前区块的高度
 }
 
 // NewBlock creates and returns Block
-func NewBlock(transactions []*Transaction, prevBlockHash []byte, height int) *Block {
-	block := &Block{time.Now().Unix(), transactions, prevBlockHash, []byte{}, 0, height}
-	pow := NewProofOfWork(block)
-	nonce, hash := pow.Run()
+func NewBlock(transactions []*Transaction, prevBlockHash []byte, height int, bits uint32) *Block {
+	block := newBlockTemplate(transactions, prevBlockHash, height, bits)
 
-	block.Hash = hash[:]
-	block.Nonce = nonce
+	err := NewMiner().Mine(context.Background(), block)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	return block
+}
+
+// newBlockTemplate 创建还没有做工作量证明的区块
+func newBlockTemplate(transactions []*Transaction, prevBlockHash []byte, height int, bits uint32) *Block {
+	block := &Block{
+		BlockHeader: BlockHeader{
+			Version:       blockVersion,
+			PrevBlockHash: prevBlockHash,
+			Timestamp:     time.Now().Unix(),
+			Bits:          bits,
+		},
+		Transactions: transactions,
+		Hash:         []byte{},
+		Height:       height,
+	}
+	block.MerkleRoot = block.HashTransactions()
 
 	return block
 }
 
 // NewGenesisBlock creates and returns genesis Block
 func NewGenesisBlock(coinbase *Transaction) *Block {
-	return NewBlock([]*Transaction{coinbase}, []byte{}, 0)
+	return NewBlock([]*Transaction{coinbase}, []byte{}, 0, activeNetParams.PowLimitBits)
 }
 
 // HashTransactions returns a hash of the transactions in the block
@@ -47,13 +65,16 @@ func (b *Block) HashTransactions() []byte {
 }
 
 // Serialize serializes the block
+// 编码格式：区块头（84字节）、高度（varint）、交易个数（varint）、各笔交易。
+// 区块Hash不参与编码，它就是区块头的Hash
 func (b *Block) Serialize() []byte {
 	var result bytes.Buffer
-	encoder := gob.NewEncoder(&result)
 
-	err := encoder.Encode(b)
-	if err != nil {
-		log.Panic(err)
+	result.Write(b.BlockHeader.Serialize())
+	writeVarInt(&result, uint64(b.Height))
+	writeVarInt(&result, uint64(len(b.Transactions)))
+	for _, tx := range b.Transactions {
+		tx.serialize(&result)
 	}
 
 	return result.Bytes()
@@ -61,13 +82,49 @@ func (b *Block) Serialize() []byte {
 
 // DeserializeBlock deserialize a block
 func DeserializeBlock(d []byte) *Block {
-	var block Block
-
-	decoder := gob.NewDecoder(bytes.NewReader(d))
-	err := decoder.Decode(&block)
+	block, err := decodeBlock(&byteReader{data: d})
 	if err != nil {
 		log.Panic(err)
 	}
 
-	return &block
+	return block
+}
+
+// decodeBlock 读取一个编码后的区块，数据必须正好是一个区块
+func decodeBlock(r *byteReader) (*Block, error) {
+	header, err := decodeBlockHeader(r)
+	if err != nil {
+		return nil, err
+	}
+
+	height, err := r.readVarInt()
+	if err != nil {
+		return nil, err
+	}
+	if height > math.MaxInt32 {
+		return nil, errors.New("block height is out of range")
+	}
+
+	count, err := r.readVarInt()
+	if err != nil {
+		return nil, err
+	}
+	if count > uint64(len(r.data)-r.pos) {
+		return nil, errors.New("too many transactions in block")
+	}
+
+	block := &Block{BlockHeader: header, Height: int(height)}
+	for i := uint64(0); i < count; i++ {
+		tx, err := decodeTransaction(r)
+		if err != nil {
+			return nil, err
+		}
+		block.Transactions = append(block.Transactions, &tx)
+	}
+	if err := r.done(); err != nil {
+		return nil, err
+	}
+	block.Hash = block.BlockHeader.Hash()
+
+	return block, nil
 }
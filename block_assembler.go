@@ -0,0 +1,178 @@
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"log"
+	"sort"
+)
+
+const maxBlockTxSize = 1 << 20 //一个区块中交易序列化后的最大总字节数
+
+// BlockTemplate 是从交易池中挑选出来准备打包的交易
+type BlockTemplate struct {
+	Height       int            //新区块的高度
+	Transactions []*Transaction //按打包顺序排列的交易，不含coinbase
+	Fees         int            //交易费总额
+	Invalid      []string       //无法打包的交易ID：输入不存在或已被花费、和已选交易冲突、签名错误
+}
+
+// mempoolEntry 交易池中的一笔候选交易
+type mempoolEntry struct {
+	tx      *Transaction
+	id      string
+	size    int
+	fee     int
+	feeRate float64 //每字节的交易费
+}
+
+// AssembleBlock 按交易费率从高到低从交易池中挑选交易。
+// 交易的输入可以来自当前链顶的UTXO集，也可以来自已经被选中的交易（交易池中的交易链），
+// 所以会多次扫描候选交易，直到没有新的交易可以加入为止。
+// 花费未成熟coinbase输出的交易这次不打包，但不算无效，仍然留在交易池中
+func (bc *Blockchain) AssembleBlock(pool map[string]Transaction) *BlockTemplate {
+	template := &BlockTemplate{}
+
+	err := bc.db.View(func(tx StorageTx) error {
+		tip := tx.Bucket([]byte(blocksBucket)).Get([]byte("l"))
+		template.Height = getBlockIndex(tx, tip).Height + 1
+
+		b := tx.Bucket([]byte(utxoBucket))
+		created := make(map[string]TXOutputs) //交易池中的交易创建的输出
+		spent := make(map[string]bool)        //已选交易花费的输出
+		blockSize := 0
+
+		for id := range pool {
+			transaction := pool[id]
+			created[id] = NewTXOutputs(&transaction, template.Height)
+		}
+
+		//先用UTXO集和交易池估算每笔交易的费率，输入找不到的交易费率记为0
+		var entries []*mempoolEntry
+		for id := range pool {
+			transaction := pool[id]
+			entry := &mempoolEntry{tx: &transaction, id: id, size: len(transaction.Serialize())}
+
+			inputs, outputs := 0, 0
+			for _, vin := range transaction.Vin {
+				if outs, ok := findOutputs(b, created, vin.Txid); ok {
+					inputs += outs.Outputs[vin.Vout].Value
+				}
+			}
+			for _, out := range transaction.Vout {
+				outputs += out.Value
+			}
+			if inputs > outputs {
+				entry.fee = inputs - outputs
+			}
+			entry.feeRate = float64(entry.fee) / float64(entry.size)
+			entries = append(entries, entry)
+		}
+		sort.Slice(entries, func(i, j int) bool {
+			if entries[i].feeRate != entries[j].feeRate {
+				return entries[i].feeRate > entries[j].feeRate
+			}
+			return entries[i].id < entries[j].id
+		})
+
+		selected := make(map[string]bool) //已选交易的ID，它们的输出可以被后面的交易花费
+		invalid := make(map[string]bool)
+
+		for progress := true; progress; {
+			progress = false
+
+			for _, entry := range entries {
+				if selected[entry.id] || invalid[entry.id] {
+					continue
+				}
+				if blockSize+entry.size > maxBlockTxSize {
+					continue
+				}
+
+				var spentOuts []TXOutput
+				inputs, outputs := 0, 0
+				ready := true
+				for _, vin := range entry.tx.Vin {
+					txID := hex.EncodeToString(vin.Txid)
+					outpoint := fmt.Sprintf("%s:%d", txID, vin.Vout)
+
+					if _, inPool := pool[txID]; inPool && !selected[txID] {
+						//父交易还没有被选中，下一轮再试；父交易无法打包时它也无法打包
+						if invalid[txID] {
+							invalid[entry.id] = true
+							progress = true
+						}
+						ready = false
+						break
+					}
+
+					outs, _ := findOutputs(b, created, vin.Txid)
+					out, ok := outs.Outputs[vin.Vout]
+					if !ok || spent[outpoint] {
+						//输出不存在或者已经被花费
+						invalid[entry.id] = true
+						progress = true
+						ready = false
+						break
+					}
+					if !outs.IsMature(template.Height) {
+						ready = false
+						break
+					}
+					spentOuts = append(spentOuts, out)
+					inputs, _ = addAmount(inputs, out.Value)
+				}
+				if !ready {
+					continue
+				}
+
+				//金额超出范围的交易和区块验证一样作为无效交易
+				inRange := true
+				for _, out := range entry.tx.Vout {
+					if outputs, inRange = addAmount(outputs, out.Value); !inRange {
+						break
+					}
+				}
+				if entry.tx.IsCoinbase() || !inRange || outputs > inputs || !entry.tx.verifyInputs(spentOuts) {
+					invalid[entry.id] = true
+					progress = true
+					continue
+				}
+
+				for _, vin := range entry.tx.Vin {
+					spent[fmt.Sprintf("%x:%d", vin.Txid, vin.Vout)] = true
+				}
+				selected[entry.id] = true
+				blockSize += entry.size
+				template.Transactions = append(template.Transactions, entry.tx)
+				template.Fees += inputs - outputs
+				progress = true
+			}
+		}
+
+		for id := range invalid {
+			template.Invalid = append(template.Invalid, id)
+		}
+
+		return nil
+	})
+	if err != nil {
+		log.Panic(err)
+	}
+
+	return template
+}
+
+// findOutputs 在UTXO集或交易池创建的输出中查找交易txid未花费的输出
+func findOutputs(b StorageBucket, created map[string]TXOutputs, txid []byte) (TXOutputs, bool) {
+	if outs, ok := created[hex.EncodeToString(txid)]; ok {
+		return outs, true
+	}
+
+	outsBytes := b.Get(txid)
+	if outsBytes == nil {
+		return TXOutputs{}, false
+	}
+
+	return DeserializeOutputs(outsBytes), true
+}
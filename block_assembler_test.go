@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newPoolTransaction 创建一笔花费 parent 第vout个输出的交易，扣除交易费后全部付给钱包自己
+func newPoolTransaction(wallet *Wallet, parent *Transaction, vout, fee int) *Transaction {
+	spent := parent.Vout[vout]
+	rtx := &RawTransaction{
+		Tx: Transaction{
+			Vin:  []TXInput{{parent.ID, vout, nil, wallet.PublicKey}},
+			Vout: []TXOutput{*NewTXOutput(spent.Value-fee, string(wallet.GetAddress()))},
+		},
+		Spent: []TXOutput{spent},
+	}
+	rtx.Sign(wallet)
+
+	return &rtx.Tx
+}
+
+func newTestPool(txs ...*Transaction) map[string]Transaction {
+	pool := make(map[string]Transaction)
+	for _, tx := range txs {
+		pool[hex.EncodeToString(tx.ID)] = *tx
+	}
+
+	return pool
+}
+
+func templateIDs(txs []*Transaction) []string {
+	var ids []string
+	for _, tx := range txs {
+		ids = append(ids, hex.EncodeToString(tx.ID))
+	}
+
+	return ids
+}
+
+func TestAssembleBlockOrdering(t *testing.T) {
+	defer func(old *ChainParams) { activeNetParams = old }(activeNetParams)
+	activeNetParams = &RegTestParams
+
+	alice := NewWallet()
+	aliceAddress := string(alice.GetAddress())
+	bc := CreateBlockchainWithStorage(NewMemoryStorage(), aliceAddress)
+	defer bc.db.Close()
+
+	coinbase := newTestCoinbase(aliceAddress, 2, 2, 2, 2, 2)
+	_, err := bc.MineBlock(context.Background(), []*Transaction{coinbase})
+	assert.Nil(t, err)
+
+	a := newPoolTransaction(alice, coinbase, 0, 1)
+	b := newPoolTransaction(alice, coinbase, 1, 0)
+	c := newPoolTransaction(alice, coinbase, 2, 2)
+	d := newPoolTransaction(alice, b, 0, 2)        //费率高但父交易b的费率为0
+	e := newPoolTransaction(alice, coinbase, 0, 0) //和费率更高的a冲突
+	missing := &Transaction{ID: []byte("missing"), Vout: []TXOutput{{2, HashPubKey(alice.PublicKey)}}}
+	f := newPoolTransaction(alice, missing, 0, 1) //输入不存在
+	g := newPoolTransaction(alice, f, 0, 1)       //父交易无效
+
+	template := bc.AssembleBlock(newTestPool(a, b, c, d, e, f, g))
+	assert.Equal(t, 2, template.Height)
+	assert.Equal(t, templateIDs([]*Transaction{c, a, b, d}), templateIDs(template.Transactions))
+	assert.Equal(t, 5, template.Fees)
+
+	invalid := templateIDs([]*Transaction{e, f, g})
+	sort.Strings(invalid)
+	sort.Strings(template.Invalid)
+	assert.Equal(t, invalid, template.Invalid)
+
+	txs := append([]*Transaction{NewCoinbaseTX(aliceAddress, "", GetBlockSubsidy(2)+template.Fees)}, template.Transactions...)
+	_, err = bc.MineBlock(context.Background(), txs)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, bc.GetBestHeight())
+}
+
+func TestAssembleBlockManyTransactions(t *testing.T) {
+	defer func(old *ChainParams) { activeNetParams = old }(activeNetParams)
+	activeNetParams = &RegTestParams
+
+	alice := NewWallet()
+	aliceAddress := string(alice.GetAddress())
+	bc := CreateBlockchainWithStorage(NewMemoryStorage(), aliceAddress)
+	defer bc.db.Close()
+
+	coinbase := newTestCoinbase(aliceAddress, 5, 5)
+	_, err := bc.MineBlock(context.Background(), []*Transaction{coinbase})
+	assert.Nil(t, err)
+
+	//两条交易池中的交易链，每笔交易费为1
+	var pool []*Transaction
+	for vout := range coinbase.Vout {
+		tx := newPoolTransaction(alice, coinbase, vout, 1)
+		pool = append(pool, tx)
+		for i := 1; i < 5; i++ {
+			tx = newPoolTransaction(alice, tx, 0, 1)
+			pool = append(pool, tx)
+		}
+	}
+
+	template := bc.AssembleBlock(newTestPool(pool...))
+	assert.Len(t, template.Transactions, len(pool))
+	assert.Empty(t, template.Invalid)
+	assert.Equal(t, len(pool), template.Fees)
+
+	txs := append([]*Transaction{NewCoinbaseTX(aliceAddress, "", GetBlockSubsidy(2)+template.Fees)}, template.Transactions...)
+	block, err := bc.MineBlock(context.Background(), txs)
+	assert.Nil(t, err)
+	assert.Equal(t, block.Hash, bc.tip)
+	assert.Equal(t, 2*GetBlockSubsidy(0)+GetBlockSubsidy(2), bc.GetAddressBalance(HashPubKey(alice.PublicKey)))
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+)
+
+const blockVersion = 1
+
+// 区块头序列化后的长度：版本4字节 + 父区块Hash 32字节 + Merkle根 32字节 + 时间戳8字节 + 难度4字节 + nonce 4字节
+const blockHeaderLen = 4 + 32 + 32 + 8 + 4 + 4
+
+// BlockHeader 区块头，工作量证明只对区块头做Hash。
+// 交易通过Merkle根提交到区块头中，所以挖矿时不需要反复计算交易的Hash，
+// 轻节点也可以只同步区块头
+type BlockHeader struct {
+	Version       int32  //区块版本
+	PrevBlockHash []byte //上一个区块的Hash值
+	MerkleRoot    []byte //区块中交易的Merkle根
+	Timestamp     int64  //时间戳，也就是区块创建的时间
+	Bits          uint32 //难度目标的compact表示，由难度调整算法根据区块链计算
+	Nonce         uint32 //计数器，也就是pow做Hash的次数
+}
+
+// Serialize 按固定的字节布局（整数为小端序）序列化区块头，Hash不足32字节时在末尾补0，
+// 创世区块的父区块Hash编码为32个0
+func (h *BlockHeader) Serialize() []byte {
+	buf := make([]byte, blockHeaderLen)
+
+	binary.LittleEndian.PutUint32(buf[0:4], uint32(h.Version))
+	copy(buf[4:36], h.PrevBlockHash)
+	copy(buf[36:68], h.MerkleRoot)
+	binary.LittleEndian.PutUint64(buf[68:76], uint64(h.Timestamp))
+	binary.LittleEndian.PutUint32(buf[76:80], h.Bits)
+	binary.LittleEndian.PutUint32(buf[80:84], h.Nonce)
+
+	return buf
+}
+
+// Hash returns the hash of the header, which is the hash of the block
+func (h *BlockHeader) Hash() []byte {
+	hash := sha256.Sum256(h.Serialize())
+
+	return hash[:]
+}
+
+// decodeBlockHeader 读取序列化后的区块头，全0的父区块Hash还原为空（创世区块）
+func decodeBlockHeader(r *byteReader) (BlockHeader, error) {
+	var h BlockHeader
+
+	buf, err := r.read(blockHeaderLen)
+	if err != nil {
+		return h, err
+	}
+
+	h.Version = int32(binary.LittleEndian.Uint32(buf[0:4]))
+	h.PrevBlockHash = append([]byte{}, buf[4:36]...)
+	if bytes.Equal(h.PrevBlockHash, make([]byte, 32)) {
+		h.PrevBlockHash = []byte{}
+	}
+	h.MerkleRoot = append([]byte{}, buf[36:68]...)
+	h.Timestamp = int64(binary.LittleEndian.Uint64(buf[68:76]))
+	h.Bits = binary.LittleEndian.Uint32(buf[76:80])
+	h.Nonce = binary.LittleEndian.Uint32(buf[80:84])
+
+	return h, nil
+}
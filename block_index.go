@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bytes"
+	"encoding/gob"
+	"log"
+	"math/big"
+)
+
+const blockIndexBucket = "blockindex"
+const orphanBucket = "orphans"
+
+// BlockIndex 记录一个区块在区块树中的位置，主链和侧链的区块都会被索引
+type BlockIndex struct {
+	Hash          []byte //区块Hash
+	PrevBlockHash []byte //父区块Hash
+	Height        int    //区块高度
+	Timestamp     int64  //区块时间戳
+	Bits          uint32 //区块难度
+	ChainWork     []byte //从创世区块到当前区块的累计工作量（big.Int的字节表示）
+}
+
+// NewBlockIndex creates an index entry for block on top of parent.
+// parent is nil for the genesis block
+func NewBlockIndex(block *Block, parent *BlockIndex) *BlockIndex {
+	work := NewProofOfWork(block).Work()
+	height := 0
+
+	if parent != nil {
+		work.Add(work, parent.Work())
+		height = parent.Height + 1
+	}
+
+	return &BlockIndex{block.Hash, block.PrevBlockHash, height, block.Timestamp, block.Bits, work.Bytes()}
+}
+
+// Work returns the cumulative chain work up to and including the block
+func (bi *BlockIndex) Work() *big.Int {
+	return new(big.Int).SetBytes(bi.ChainWork)
+}
+
+// Serialize serializes the block index entry
+func (bi *BlockIndex) Serialize() []byte {
+	var result bytes.Buffer
+	encoder := gob.NewEncoder(&result)
+
+	err := encoder.Encode(bi)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	return result.Bytes()
+}
+
+// DeserializeBlockIndex deserializes a block index entry
+func DeserializeBlockIndex(d []byte) *BlockIndex {
+	var bi BlockIndex
+
+	decoder := gob.NewDecoder(bytes.NewReader(d))
+	err := decoder.Decode(&bi)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	return &bi
+}
+
+// getBlockIndex 在事务内读取区块索引，不存在时返回nil
+func getBlockIndex(tx StorageTx, hash []byte) *BlockIndex {
+	data := tx.Bucket([]byte(blockIndexBucket)).Get(hash)
+	if data == nil {
+		return nil
+	}
+
+	return DeserializeBlockIndex(data)
+}
+
+// putBlockIndex 在事务内保存区块索引
+func putBlockIndex(tx StorageTx, bi *BlockIndex) {
+	err := tx.Bucket([]byte(blockIndexBucket)).Put(bi.Hash, bi.Serialize())
+	if err != nil {
+		log.Panic(err)
+	}
+}
+
+// putOrphan 记录一个父区块未知的孤块，key为 父区块Hash+区块Hash
+func putOrphan(tx StorageTx, block *Block) {
+	key := append(append([]byte{}, block.PrevBlockHash...), block.Hash...)
+	err := tx.Bucket([]byte(orphanBucket)).Put(key, block.Hash)
+	if err != nil {
+		log.Panic(err)
+	}
+}
+
+// takeOrphans 取出并删除所有以parentHash为父区块的孤块Hash
+func takeOrphans(tx StorageTx, parentHash []byte) [][]byte {
+	var hashes [][]byte
+	var keys [][]byte
+	b := tx.Bucket([]byte(orphanBucket))
+	c := b.Cursor()
+
+	for k, v := c.Seek(parentHash); k != nil && bytes.HasPrefix(k, parentHash); k, v = c.Next() {
+		keys = append(keys, append([]byte{}, k...))
+		hashes = append(hashes, append([]byte{}, v...))
+	}
+
+	for _, k := range keys {
+		err := b.Delete(k)
+		if err != nil {
+			log.Panic(err)
+		}
+	}
+
+	return hashes
+}
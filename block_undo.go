@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bytes"
+	"encoding/gob"
+	"log"
+)
+
+const undoBucket = "undo"
+
+// SpentOutput 记录一个被区块花费的输出，断开区块时用它把输出放回UTXO集
+type SpentOutput struct {
+	Txid       []byte   //被花费输出所在交易的Hash
+	Vout       int      //输出在交易中的索引
+	Output     TXOutput //被花费的输出
+	Height     int      //被花费输出所在区块的高度
+	IsCoinbase bool     //被花费的输出是否来自coinbase交易
+}
+
+// BlockUndo 保存一个区块花费的所有输出，按花费顺序排列
+type BlockUndo struct {
+	Spent []SpentOutput
+}
+
+// Serialize serializes the undo record
+func (u BlockUndo) Serialize() []byte {
+	var result bytes.Buffer
+	encoder := gob.NewEncoder(&result)
+
+	err := encoder.Encode(u)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	return result.Bytes()
+}
+
+// DeserializeBlockUndo deserializes an undo record
+func DeserializeBlockUndo(d []byte) BlockUndo {
+	var undo BlockUndo
+
+	decoder := gob.NewDecoder(bytes.NewReader(d))
+	err := decoder.Decode(&undo)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	return undo
+}
+
+// getBlockUndo 在事务内读取区块的撤销数据
+func getBlockUndo(tx StorageTx, blockHash []byte) (BlockUndo, bool) {
+	data := tx.Bucket([]byte(undoBucket)).Get(blockHash)
+	if data == nil {
+		return BlockUndo{}, false
+	}
+
+	return DeserializeBlockUndo(data), true
+}
+
+// putBlockUndo 在事务内保存区块的撤销数据
+func putBlockUndo(tx StorageTx, blockHash []byte, undo BlockUndo) {
+	err := tx.Bucket([]byte(undoBucket)).Put(blockHash, undo.Serialize())
+	if err != nil {
+		log.Panic(err)
+	}
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"time"
+)
+
+const maxFutureBlockTime = 2 * 60 * 60 //区块时间戳最多允许超前本地时间2小时
+const medianTimeSpan = 11              //计算过去中位时间时使用的区块数
+
+// BlockValidationError 表示区块违反了共识规则
+type BlockValidationError struct {
+	Hash   []byte //区块Hash
+	Reason string //拒绝原因
+}
+
+func (e *BlockValidationError) Error() string {
+	return fmt.Sprintf("Invalid block %x: %s", e.Hash, e.Reason)
+}
+
+func invalidBlock(block *Block, format string, a ...interface{}) error {
+	return &BlockValidationError{block.Hash, fmt.Sprintf(format, a...)}
+}
+
+// ValidateBlock 在区块加入区块链之前检查它是否满足共识规则：
+// 1、工作量证明、交易结构、时间戳等不依赖区块链的检查
+// 2、父区块存在、高度为父区块高度+1、难度等于难度调整算法的计算结果、时间戳不早于过去中位时间
+// 3、如果父区块是当前链顶，再对照UTXO集检查交易的输入、签名和coinbase金额
+// 父区块不存在时返回ErrOrphanBlock，其他情况返回*BlockValidationError
+func (bc *Blockchain) ValidateBlock(block *Block) error {
+	err := checkBlock(block)
+	if err != nil {
+		return err
+	}
+
+	return bc.db.View(func(tx StorageTx) error {
+		parent := getBlockIndex(tx, block.PrevBlockHash)
+		if parent == nil {
+			return ErrOrphanBlock
+		}
+
+		err := checkBlockContext(tx, block, parent)
+		if err != nil {
+			return err
+		}
+
+		tip := tx.Bucket([]byte(blocksBucket)).Get([]byte("l"))
+		if bytes.Compare(parent.Hash, tip) == 0 {
+			return checkBlockInputs(tx, block)
+		}
+
+		//侧链上的区块在链重组连接时再检查输入
+		return nil
+	})
+}
+
+// checkBlock 执行不依赖区块链状态的检查
+func checkBlock(block *Block) error {
+	pow := NewProofOfWork(block)
+	if bytes.Compare(block.BlockHeader.Hash(), block.Hash) != 0 {
+		return invalidBlock(block, "block hash does not match its header")
+	}
+	if pow.target.Sign() <= 0 || pow.target.Cmp(activeNetParams.PowLimit) > 0 {
+		return invalidBlock(block, "target of bits %08x is out of range", block.Bits)
+	}
+	if !pow.Validate() {
+		return invalidBlock(block, "proof of work is not valid")
+	}
+
+	if block.Timestamp > time.Now().Unix()+maxFutureBlockTime {
+		return invalidBlock(block, "timestamp %d is too far in the future", block.Timestamp)
+	}
+
+	if len(block.Transactions) == 0 || !block.Transactions[0].IsCoinbase() {
+		return invalidBlock(block, "first transaction is not a coinbase")
+	}
+	if bytes.Compare(block.MerkleRoot, block.HashTransactions()) != 0 {
+		return invalidBlock(block, "merkle root does not match the transactions")
+	}
+
+	txIDs := make(map[string]bool)
+	spent := make(map[string]bool)
+	for i, tx := range block.Transactions {
+		if i > 0 && tx.IsCoinbase() {
+			return invalidBlock(block, "more than one coinbase")
+		}
+		if txIDs[hex.EncodeToString(tx.ID)] {
+			return invalidBlock(block, "duplicate transaction %x", tx.ID)
+		}
+		txIDs[hex.EncodeToString(tx.ID)] = true
+
+		if len(tx.Vin) == 0 || len(tx.Vout) == 0 {
+			return invalidBlock(block, "transaction %x has no inputs or outputs", tx.ID)
+		}
+		//每个输出和输出总额都不能超过币的总量上限，防止金额相加时溢出
+		total, ok := 0, true
+		for _, out := range tx.Vout {
+			if out.Value < 0 || out.Value > activeNetParams.MaxSupply {
+				return invalidBlock(block, "transaction %x has an output value out of range", tx.ID)
+			}
+			if total, ok = addAmount(total, out.Value); !ok {
+				return invalidBlock(block, "transaction %x has outputs above the max supply", tx.ID)
+			}
+		}
+
+		if tx.IsCoinbase() {
+			continue
+		}
+		for _, vin := range tx.Vin {
+			outpoint := fmt.Sprintf("%x:%d", vin.Txid, vin.Vout)
+			if spent[outpoint] {
+				return invalidBlock(block, "output %s is spent twice in the block", outpoint)
+			}
+			spent[outpoint] = true
+		}
+	}
+
+	return nil
+}
+
+// checkBlockContext 执行依赖父区块的检查
+func checkBlockContext(tx StorageTx, block *Block, parent *BlockIndex) error {
+	if block.Height != parent.Height+1 {
+		return invalidBlock(block, "height %d does not follow parent height %d", block.Height, parent.Height)
+	}
+
+	expectedBits := calcNextBits(tx, parent)
+	if block.Bits != expectedBits {
+		return invalidBlock(block, "bits %08x does not match expected difficulty %08x", block.Bits, expectedBits)
+	}
+
+	mtp := medianTimePast(tx, parent)
+	if block.Timestamp < mtp {
+		return invalidBlock(block, "timestamp %d is earlier than median time past %d", block.Timestamp, mtp)
+	}
+
+	return nil
+}
+
+// checkBlockInputs 对照事务内的UTXO集检查区块中的交易，UTXO集必须对应区块的父区块：
+// 每个输入引用的输出都存在且没有被花费，coinbase的输出已经成熟，签名正确，输出总额不超过输入总额，
+// coinbase的金额不超过该高度的区块奖励加上交易费
+func checkBlockInputs(tx StorageTx, block *Block) error {
+	b := tx.Bucket([]byte(utxoBucket))
+	created := make(map[string]TXOutputs) //区块内前面的交易创建的输出
+	fees, ok := 0, true
+
+	for _, transaction := range block.Transactions {
+		if !transaction.IsCoinbase() {
+			var spent []TXOutput
+			inputs, outputs := 0, 0
+
+			for _, vin := range transaction.Vin {
+				txID := hex.EncodeToString(vin.Txid)
+				outs, ok := created[txID]
+				if !ok {
+					outsBytes := b.Get(vin.Txid)
+					if outsBytes == nil {
+						return invalidBlock(block, "input %x:%d is missing or spent", vin.Txid, vin.Vout)
+					}
+					outs = DeserializeOutputs(outsBytes)
+				}
+
+				out, ok := outs.Outputs[vin.Vout]
+				if !ok {
+					return invalidBlock(block, "input %x:%d is missing or spent", vin.Txid, vin.Vout)
+				}
+				if !outs.IsMature(block.Height) {
+					return invalidBlock(block, "input %x:%d spends an immature coinbase", vin.Txid, vin.Vout)
+				}
+				spent = append(spent, out)
+				if inputs, ok = addAmount(inputs, out.Value); !ok {
+					return invalidBlock(block, "transaction %x has inputs above the max supply", transaction.ID)
+				}
+			}
+
+			for _, out := range transaction.Vout {
+				if outputs, ok = addAmount(outputs, out.Value); !ok {
+					return invalidBlock(block, "transaction %x has outputs above the max supply", transaction.ID)
+				}
+			}
+			if outputs > inputs {
+				return invalidBlock(block, "transaction %x spends more than its inputs", transaction.ID)
+			}
+			if !transaction.verifyInputs(spent) {
+				return invalidBlock(block, "transaction %x has an invalid signature", transaction.ID)
+			}
+			if fees, ok = addAmount(fees, inputs-outputs); !ok {
+				return invalidBlock(block, "fees of the block are above the max supply")
+			}
+		}
+
+		created[hex.EncodeToString(transaction.ID)] = NewTXOutputs(transaction, block.Height)
+	}
+
+	reward := 0
+	for _, out := range block.Transactions[0].Vout {
+		if reward, ok = addAmount(reward, out.Value); !ok {
+			return invalidBlock(block, "coinbase pays more than the max supply")
+		}
+	}
+	blockSubsidy := GetBlockSubsidy(block.Height)
+	if reward > blockSubsidy+fees {
+		return invalidBlock(block, "coinbase pays %d, more than subsidy plus fees %d", reward, blockSubsidy+fees)
+	}
+
+	return nil
+}
+
+// addAmount 把金额value加到total上，value为负数或者结果超过币的总量上限时返回false。
+// total 不超过上限，所以比较时不会溢出
+func addAmount(total, value int) (int, bool) {
+	if value < 0 || value > activeNetParams.MaxSupply-total {
+		return total, false
+	}
+
+	return total + value, true
+}
+
+// medianTimePast 返回以parent结尾的最近medianTimeSpan个区块时间戳的中位数
+func medianTimePast(tx StorageTx, parent *BlockIndex) int64 {
+	var timestamps []int64
+
+	for bi := parent; bi != nil && len(timestamps) < medianTimeSpan; {
+		timestamps = append(timestamps, bi.Timestamp)
+		if len(bi.PrevBlockHash) == 0 {
+			break
+		}
+		bi = getBlockIndex(tx, bi.PrevBlockHash)
+	}
+
+	sort.Slice(timestamps, func(i, j int) bool { return timestamps[i] < timestamps[j] })
+
+	return timestamps[len(timestamps)/2]
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestTransaction 创建一笔花费 txid:0 的交易，checkBlock 不检查签名
+func newTestTransaction(txid []byte, value int) *Transaction {
+	tx := &Transaction{nil, []TXInput{{txid, 0, nil, nil}}, []TXOutput{{value, []byte("pubKeyHash")}}}
+	tx.ID = tx.unsignedHash()
+
+	return tx
+}
+
+// newTestCoinbase 创建一笔向address支付多个输出的coinbase
+func newTestCoinbase(address string, values ...int) *Transaction {
+	tx := NewCoinbaseTX(address, "", 0)
+	tx.Vout = nil
+	for _, value := range values {
+		tx.Vout = append(tx.Vout, *NewTXOutput(value, address))
+	}
+	tx.ID = tx.unsignedHash()
+
+	return tx
+}
+
+func TestCheckBlockTransactionCount(t *testing.T) {
+	defer func(old *ChainParams) { activeNetParams = old }(activeNetParams)
+	activeNetParams = &RegTestParams
+
+	for n := 1; n <= 9; n++ {
+		txs := []*Transaction{NewCoinbaseTX(string(NewWallet().GetAddress()), "", GetBlockSubsidy(1))}
+		for i := 1; i < n; i++ {
+			txs = append(txs, newTestTransaction([]byte(fmt.Sprintf("tx%d", i)), i))
+		}
+
+		block := NewBlock(txs, []byte{}, 1, RegTestParams.PowLimitBits)
+		assert.Nil(t, checkBlock(block), "block with %d transactions", n)
+
+		//交换两笔交易后Merkle根不再匹配
+		if n > 1 {
+			block.Transactions[n-1], block.Transactions[n-2] = block.Transactions[n-2], block.Transactions[n-1]
+			assert.Error(t, checkBlock(block), "block with %d reordered transactions", n)
+		}
+	}
+}
+
+func TestCheckBlockOutputOverflow(t *testing.T) {
+	defer func(old *ChainParams) { activeNetParams = old }(activeNetParams)
+	activeNetParams = &RegTestParams
+	maxSupply := RegTestParams.MaxSupply
+
+	coinbase := func(values ...int) *Transaction {
+		return newTestCoinbase(string(NewWallet().GetAddress()), values...)
+	}
+
+	//相加后回绕成12的coinbase
+	block := NewBlock([]*Transaction{coinbase(math.MaxInt64, math.MaxInt64, 12)}, []byte{}, 1, RegTestParams.PowLimitBits)
+	assert.Error(t, checkBlock(block))
+
+	//每个输出都不超过上限，但总额超过
+	block = NewBlock([]*Transaction{coinbase(maxSupply, 1)}, []byte{}, 1, RegTestParams.PowLimitBits)
+	assert.Error(t, checkBlock(block))
+
+	//普通交易的输出相加回绕后小于输入，不能绕过输出不超过输入的检查
+	tx := newTestTransaction([]byte("tx"), 1)
+	tx.Vout = append(tx.Vout, TXOutput{math.MaxInt64, []byte("pubKeyHash")}, TXOutput{math.MaxInt64, []byte("pubKeyHash")})
+	tx.ID = tx.unsignedHash()
+	block = NewBlock([]*Transaction{coinbase(1), tx}, []byte{}, 1, RegTestParams.PowLimitBits)
+	assert.Error(t, checkBlock(block))
+
+	block = NewBlock([]*Transaction{coinbase(maxSupply)}, []byte{}, 1, RegTestParams.PowLimitBits)
+	assert.Nil(t, checkBlock(block))
+
+	total, ok := addAmount(maxSupply-1, 1)
+	assert.True(t, ok)
+	assert.Equal(t, maxSupply, total)
+	_, ok = addAmount(maxSupply, 1)
+	assert.False(t, ok)
+	_, ok = addAmount(0, -1)
+	assert.False(t, ok)
+}
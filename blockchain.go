@@ -2,59 +2,85 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"crypto/ecdsa"
 	"encoding/hex"
 	"errors"
 	"fmt"
 	"log"
 	"os"
-
-	"github.com/boltdb/bolt"
 )
 
 const dbFile = "blockchain.db"
 const blocksBucket = "blocks"
-const genesisCoinbaseData = "The Times 03/Jan/2009 Chancellor on brink of second bailout for banks"
+
+// dbFormatVersion 数据库格式的版本，保存在block表的"v"中。
+// 版本1的区块和交易使用 serialization.go 中的编码，之前的版本用gob编码，没有"v"。
+// 版本2的地址索引key中公钥Hash前面加上了长度
+const dbFormatVersion = 2
+
+// ErrOrphanBlock 表示区块的父区块还不存在
+var ErrOrphanBlock = errors.New("Orphan block: previous block is not found")
+
+// ErrOldDatabase 表示数据库是旧版本用gob编码创建的。
+// 旧的交易ID和签名都是按gob编码计算的，无法转换，只能重新创建区块链或者从其他节点同步
+var ErrOldDatabase = errors.New("the blockchain database was created by an older version with an incompatible format, " +
+	"delete it and run createblockchain again or sync from another node")
 
 type Blockchain struct {
 	tip []byte
-	db  *bolt.DB
+	db  Storage
 }
 
 // 创建新的Blockchain，返回BLockChain对象
 //Address 创世区块coinbase奖励的接收地址
 //nodeID 节点标识符
 func CreateBlockchain(address string) *Blockchain {
-	if dbExists(dbFile) {
+	if dbExists(dbPath()) {
 		fmt.Println("Blockchain already exists.")
 		os.Exit(1)
 	}
 
-	var tip []byte
-
-	cbtx := NewCoinbaseTX(address, genesisCoinbaseData) //创建一个新的coinBase交易
-	genesis := NewGenesisBlock(cbtx)                    //创建创世区块
-
-	db, err := bolt.Open(dbFile, 0600, nil)
+	db, err := OpenBoltStorage(dbPath())
 	if err != nil {
 		log.Panic(err)
 	}
 
-	err = db.Update(func(tx *bolt.Tx) error {
+	return CreateBlockchainWithStorage(db, address)
+}
+
+// CreateBlockchainWithStorage creates a new blockchain in the empty storage
+func CreateBlockchainWithStorage(db Storage, address string) *Blockchain {
+	var tip []byte
+
+	cbtx := NewCoinbaseTX(address, activeNetParams.GenesisCoinbaseData, GetBlockSubsidy(0)) //创建一个新的coinBase交易
+	genesis := NewGenesisBlock(cbtx)                                                        //创建创世区块
+
+	err := db.Update(func(tx StorageTx) error {
 		b, err := tx.CreateBucket([]byte(blocksBucket)) //创建block表
 		if err != nil {
 			log.Panic(err)
 		}
+		createChainBuckets(tx)
 
 		err = b.Put(genesis.Hash, genesis.Serialize()) //保存创世区块到block表{Hash:block}
 		if err != nil {
 			log.Panic(err)
 		}
+		putBlockIndex(tx, NewBlockIndex(genesis, nil))
+		putHeight(tx, 0, genesis.Hash)
+		UTXOSet{}.connectBlock(tx, genesis) //创世区块的输出直接加入UTXO集
+		indexBlockAddresses(tx, genesis, BlockUndo{})
+		indexBlockTransactions(tx, genesis)
 
 		err = b.Put([]byte("l"), genesis.Hash) //保存当前最新的Hash到block表{"l":Hash}
 		if err != nil {
 			log.Panic(err)
 		}
+		err = b.Put([]byte("v"), []byte{dbFormatVersion})
+		if err != nil {
+			log.Panic(err)
+		}
 		tip = genesis.Hash
 
 		return nil
@@ -70,20 +96,87 @@ func CreateBlockchain(address string) *Blockchain {
 
 // 加载当前blockchain
 func NewBlockchain() *Blockchain {
-	if dbExists(dbFile) == false {
+	if dbExists(dbPath()) == false {
 		fmt.Println("No existing blockchain found. Create one first.")
 		os.Exit(1)
 	}
 
+	db, err := OpenBoltStorage(dbPath())
+	if err != nil {
+		log.Panic(err)
+	}
+
+	err = checkDBFormat(db)
+	if err != nil {
+		db.Close()
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	return NewBlockchainWithStorage(db)
+}
+
+// checkDBFormat 检查数据库格式的版本，旧版本的数据库升级到当前版本。
+// 没有版本号时尝试按当前格式解码最新的区块，能解码说明是版本1，否则是gob编码的旧数据库
+func checkDBFormat(db Storage) error {
+	return db.Update(func(tx StorageTx) error {
+		b := tx.Bucket([]byte(blocksBucket))
+		if b == nil {
+			return ErrOldDatabase
+		}
+
+		version := b.Get([]byte("v"))
+		if version == nil {
+			_, err := decodeBlock(&byteReader{data: b.Get(b.Get([]byte("l")))})
+			if err != nil {
+				return ErrOldDatabase
+			}
+			version = []byte{1}
+		}
+		if len(version) != 1 || version[0] == 0 || version[0] > dbFormatVersion {
+			return fmt.Errorf("unsupported blockchain database version %x", version)
+		}
+		if version[0] == dbFormatVersion {
+			return nil
+		}
+
+		//版本1的地址索引删除后由 NewBlockchainWithStorage 按新的key重建
+		err := tx.DeleteBucket([]byte(addrIndexBucket))
+		if err != nil && err != ErrBucketNotFound {
+			return err
+		}
+
+		return b.Put([]byte("v"), []byte{dbFormatVersion})
+	})
+}
+
+// NewBlockchainWithStorage loads the blockchain from the storage
+func NewBlockchainWithStorage(db Storage) *Blockchain {
 	var tip []byte
-	db, err := bolt.Open(dbFile, 0600, nil)
+
+	err := checkDBFormat(db)
 	if err != nil {
 		log.Panic(err)
 	}
 
-	err = db.Update(func(tx *bolt.Tx) error {
+	err = db.Update(func(tx StorageTx) error {
 		b := tx.Bucket([]byte(blocksBucket))
 		tip = b.Get([]byte("l"))
+
+		//旧版本的数据库没有区块索引、高度索引和地址索引，按主链重建一次
+		needIndex := tx.Bucket([]byte(blockIndexBucket)) == nil
+		needHeights := tx.Bucket([]byte(heightIndexBucket)) == nil
+		needAddresses := tx.Bucket([]byte(addrIndexBucket)) == nil
+		createChainBuckets(tx)
+		if needIndex {
+			indexMainChain(tx, tip)
+		}
+		if needHeights {
+			indexHeights(tx, tip)
+		}
+		if needAddresses {
+			indexAddresses(tx, tip)
+		}
 		return nil
 	})
 	if err != nil {
@@ -95,42 +188,259 @@ func NewBlockchain() *Blockchain {
 }
 
 // AddBlock saves the block into the blockchain
-func (bc *Blockchain) AddBlock(block *Block) {
-	err := bc.db.Update(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte(blocksBucket))
-		blockInDb := b.Get(block.Hash)
+// 区块通过共识检查后被保存并加入区块树，如果它所在分支的累计工作量超过当前主链，则进行链重组。
+// 链重组时返回从主链上断开的区块中、没有包含在新主链中的交易，调用方应把它们放回交易池。
+// 父区块未知的区块作为孤块保存，返回ErrOrphanBlock，父区块到达后会被自动接上。
+// 违反共识规则的区块不会被保存，返回*BlockValidationError
+func (bc *Blockchain) AddBlock(block *Block) ([]Transaction, error) {
+	var newTip []byte
+	var disconnected []Transaction
+	orphan := false
+
+	err := checkBlock(block)
+	if err != nil {
+		return nil, err
+	}
 
-		if blockInDb != nil {
+	err = bc.db.Update(func(tx StorageTx) error {
+		b := tx.Bucket([]byte(blocksBucket))
+		if b.Get(block.Hash) != nil {
 			return nil
 		}
 
-		blockData := block.Serialize()
-		err := b.Put(block.Hash, blockData)
+		err := b.Put(block.Hash, block.Serialize())
 		if err != nil {
 			log.Panic(err)
 		}
 
-		lastHash := b.Get([]byte("l"))
-		lastBlockData := b.Get(lastHash)
-		lastBlock := DeserializeBlock(lastBlockData)
+		parent := getBlockIndex(tx, block.PrevBlockHash)
+		if parent == nil {
+			putOrphan(tx, block)
+			orphan = true
+			return nil
+		}
+
+		best, err := connectToTree(tx, block, parent)
+		if err != nil {
+			return err
+		}
 
-		if block.Height > lastBlock.Height {
-			err = b.Put([]byte("l"), block.Hash)
+		tipIndex := getBlockIndex(tx, b.Get([]byte("l")))
+		if best.Work().Cmp(tipIndex.Work()) > 0 {
+			disconnected, err = bc.reorganize(tx, tipIndex, best)
 			if err != nil {
-				log.Panic(err)
+				return err
 			}
-			bc.tip = block.Hash
+			newTip = best.Hash
 		}
 
 		return nil
 	})
+	if _, ok := err.(*BlockValidationError); ok {
+		return nil, err
+	}
 	if err != nil {
 		log.Panic(err)
 	}
+	if orphan {
+		return nil, ErrOrphanBlock
+	}
+	if newTip != nil {
+		bc.tip = newTip
+	}
+
+	return disconnected, nil
+}
+
+// connectToTree 检查区块与父区块的关系并为它建立索引，再把等待该区块的孤块依次接入区块树，
+// 不合法的孤块会被丢弃。返回新接入区块中累计工作量最大的那个
+func connectToTree(tx StorageTx, block *Block, parent *BlockIndex) (*BlockIndex, error) {
+	b := tx.Bucket([]byte(blocksBucket))
+
+	err := checkBlockContext(tx, block, parent)
+	if err != nil {
+		return nil, err
+	}
+	best := NewBlockIndex(block, parent)
+	putBlockIndex(tx, best)
+
+	queue := []*BlockIndex{best}
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+
+		for _, hash := range takeOrphans(tx, current.Hash) {
+			orphan := DeserializeBlock(b.Get(hash))
+			err := checkBlockContext(tx, orphan, current)
+			if err != nil {
+				fmt.Println("丢弃孤块：", err)
+				continue
+			}
+
+			child := NewBlockIndex(orphan, current)
+			putBlockIndex(tx, child)
+			queue = append(queue, child)
+
+			if child.Work().Cmp(best.Work()) > 0 {
+				best = child
+			}
+		}
+	}
+
+	return best, nil
+}
+
+// reorganize 把主链从oldTip切换到newTip：
+// 先从旧链顶开始逐个断开分叉点之后的区块（恢复它们花费的输出），再按高度顺序检查并连接新分支的区块，
+// 同时更新高度索引、交易索引和地址索引。返回断开的区块中没有被新分支包含的非coinbase交易，按原来的链上顺序排列。
+// 新分支上有不合法的区块时返回错误，调用方回滚整个事务，主链保持不变
+func (bc *Blockchain) reorganize(tx StorageTx, oldTip, newTip *BlockIndex) ([]Transaction, error) {
+	var detach, attach []*BlockIndex
+	b := tx.Bucket([]byte(blocksBucket))
+	UTXOSet := UTXOSet{bc}
+
+	oldNode, newNode := oldTip, newTip
+	for newNode.Height > oldNode.Height {
+		attach = append(attach, newNode)
+		newNode = getBlockIndex(tx, newNode.PrevBlockHash)
+	}
+	for oldNode.Height > newNode.Height {
+		detach = append(detach, oldNode)
+		oldNode = getBlockIndex(tx, oldNode.PrevBlockHash)
+	}
+	for bytes.Compare(oldNode.Hash, newNode.Hash) != 0 {
+		detach = append(detach, oldNode)
+		attach = append(attach, newNode)
+		oldNode = getBlockIndex(tx, oldNode.PrevBlockHash)
+		newNode = getBlockIndex(tx, newNode.PrevBlockHash)
+	}
+
+	var detachedTxs []Transaction
+	for _, bi := range detach {
+		block := DeserializeBlock(b.Get(bi.Hash))
+		unindexBlockAddresses(tx, block, loadBlockUndo(tx, block))
+		UTXOSet.disconnectBlock(tx, block)
+		deleteHeight(tx, bi.Height)
+		unindexBlockTransactions(tx, block)
+
+		//从链顶往回断开，交易逆序加入，最后再整体反转
+		for i := len(block.Transactions) - 1; i > 0; i-- {
+			detachedTxs = append(detachedTxs, *block.Transactions[i])
+		}
+	}
+	attached := make(map[string]bool)
+	for i := len(attach) - 1; i >= 0; i-- {
+		block := DeserializeBlock(b.Get(attach[i].Hash))
+		err := checkBlockInputs(tx, block)
+		if err != nil {
+			return nil, err
+		}
+		UTXOSet.connectBlock(tx, block)
+		putHeight(tx, block.Height, block.Hash)
+		indexBlockTransactions(tx, block)
+		indexBlockAddresses(tx, block, loadBlockUndo(tx, block))
+
+		for _, transaction := range block.Transactions {
+			attached[hex.EncodeToString(transaction.ID)] = true
+		}
+	}
+
+	err := b.Put([]byte("l"), newTip.Hash)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	if len(detach) > 0 {
+		fmt.Printf("链重组：断开%d个区块，连接%d个区块，分叉点高度%d\n", len(detach), len(attach), oldNode.Height)
+	}
+
+	var disconnected []Transaction
+	for i := len(detachedTxs) - 1; i >= 0; i-- {
+		if !attached[hex.EncodeToString(detachedTxs[i].ID)] {
+			disconnected = append(disconnected, detachedTxs[i])
+		}
+	}
+
+	return disconnected, nil
+}
+
+// findTransactionFrom 在事务内从block开始沿父区块向前查找交易，返回交易和它所在的区块，
+// 用于断开区块时找回被花费的输出
+func findTransactionFrom(tx StorageTx, block *Block, ID []byte) (*Transaction, *Block) {
+	b := tx.Bucket([]byte(blocksBucket))
+
+	for {
+		for _, transaction := range block.Transactions {
+			if bytes.Compare(transaction.ID, ID) == 0 {
+				return transaction, block
+			}
+		}
+
+		if len(block.PrevBlockHash) == 0 {
+			return nil, nil
+		}
+		block = DeserializeBlock(b.Get(block.PrevBlockHash))
+	}
+}
+
+// createChainBuckets 创建区块索引、孤块、UTXO、撤销数据、高度索引和地址索引表
+func createChainBuckets(tx StorageTx) {
+	for _, name := range []string{blockIndexBucket, orphanBucket, utxoBucket, undoBucket, heightIndexBucket, addrIndexBucket} {
+		_, err := tx.CreateBucketIfNotExists([]byte(name))
+		if err != nil {
+			log.Panic(err)
+		}
+	}
+}
+
+// indexMainChain 为从创世区块到tip的主链区块建立索引
+func indexMainChain(tx StorageTx, tip []byte) {
+	var blocks []*Block
+	b := tx.Bucket([]byte(blocksBucket))
+
+	for hash := tip; len(hash) > 0; {
+		block := DeserializeBlock(b.Get(hash))
+		blocks = append(blocks, block)
+		hash = block.PrevBlockHash
+	}
+
+	var parent *BlockIndex
+	for i := len(blocks) - 1; i >= 0; i-- {
+		parent = NewBlockIndex(blocks[i], parent)
+		putBlockIndex(tx, parent)
+	}
 }
 
 // FindTransaction finds a transaction by its ID
+// 开启了交易索引时直接按索引读取，否则从链顶开始遍历整条链
 func (bc *Blockchain) FindTransaction(ID []byte) (Transaction, error) {
+	var transaction *Transaction
+	indexed := false
+
+	err := bc.db.View(func(tx StorageTx) error {
+		if tx.Bucket([]byte(txIndexBucket)) == nil {
+			return nil
+		}
+		indexed = true
+
+		loc, ok := getTxLocation(tx, ID)
+		if ok {
+			block := DeserializeBlock(tx.Bucket([]byte(blocksBucket)).Get(loc.BlockHash))
+			transaction = block.Transactions[loc.Index]
+		}
+
+		return nil
+	})
+	if err != nil {
+		log.Panic(err)
+	}
+	if transaction != nil {
+		return *transaction, nil
+	}
+	if indexed {
+		return Transaction{}, errors.New("Transaction is not found")
+	}
+
 	bci := bc.Iterator()
 
 	for {
@@ -173,8 +483,11 @@ func (bc *Blockchain) FindUTXO() map[string]TXOutputs {
 					}
 				}
 
-				outs := UTXO[txID]
-				outs.Outputs = append(outs.Outputs, out)
+				outs, ok := UTXO[txID]
+				if !ok {
+					outs = TXOutputs{make(map[int]TXOutput), block.Height, tx.IsCoinbase()}
+				}
+				outs.Outputs[outIdx] = out
 				UTXO[txID] = outs
 			}
 
@@ -206,7 +519,7 @@ func (bc *Blockchain) Iterator() *BlockchainIterator {
 func (bc *Blockchain) GetBestHeight() int {
 	var lastBlock Block
 
-	err := bc.db.View(func(tx *bolt.Tx) error {
+	err := bc.db.View(func(tx StorageTx) error {
 		b := tx.Bucket([]byte(blocksBucket))
 		lastHash := b.Get([]byte("l"))
 		blockData := b.Get(lastHash)
@@ -225,7 +538,7 @@ func (bc *Blockchain) GetBestHeight() int {
 func (bc *Blockchain) GetBlock(blockHash []byte) (Block, error) {
 	var block Block
 
-	err := bc.db.View(func(tx *bolt.Tx) error {
+	err := bc.db.View(func(tx StorageTx) error {
 		b := tx.Bucket([]byte(blocksBucket))
 
 		blockData := b.Get(blockHash)
@@ -245,45 +558,38 @@ func (bc *Blockchain) GetBlock(blockHash []byte) (Block, error) {
 	return block, nil
 }
 
-// 返回从指定高度到本区块链最新高度的所有区块的Hash列表
-func (bc *Blockchain) GetBlockHashes(fromHeight int) [][]byte {
-	var blocks [][]byte
-	bci := bc.Iterator()
+// GetBlockByHeight finds the main chain block at the given height
+func (bc *Blockchain) GetBlockByHeight(height int) (Block, error) {
+	var block Block
 
-	for {
-		block := bci.Next()
-		if block.Height == fromHeight {
-			break
-		}
-		blocks = append(blocks, block.Hash)
-		if len(block.PrevBlockHash) == 0 {
-			break
+	err := bc.db.View(func(tx StorageTx) error {
+		hash := getHashByHeight(tx, height)
+		if hash == nil {
+			return errors.New("Block is not found.")
 		}
+
+		block = *DeserializeBlock(tx.Bucket([]byte(blocksBucket)).Get(hash))
+
+		return nil
+	})
+	if err != nil {
+		return block, err
 	}
 
-	return blocks
+	return block, nil
 }
 
-// MineBlock mines a new block with the provided transactions
-func (bc *Blockchain) MineBlock(transactions []*Transaction) *Block {
-	var lastHash []byte
-	var lastHeight int
+// 返回主链上高于指定高度的所有区块的Hash列表，按高度从低到高排列，
+// 这样peer按顺序下载时每个区块的父区块都已经存在
+func (bc *Blockchain) GetBlockHashes(fromHeight int) [][]byte {
+	var blocks [][]byte
 
-	for _, tx := range transactions {
+	err := bc.db.View(func(tx StorageTx) error {
+		c := tx.Bucket([]byte(heightIndexBucket)).Cursor()
 
-		if bc.VerifyTransaction(tx) != true {
-			log.Panic("ERROR: Invalid transaction")
+		for k, v := c.Seek(IntToHex(int64(fromHeight + 1))); k != nil; k, v = c.Next() {
+			blocks = append(blocks, append([]byte{}, v...))
 		}
-	}
-
-	err := bc.db.View(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte(blocksBucket))
-		lastHash = b.Get([]byte("l"))
-
-		blockData := b.Get(lastHash)
-		block := DeserializeBlock(blockData)
-
-		lastHeight = block.Height
 
 		return nil
 	})
@@ -291,29 +597,55 @@ func (bc *Blockchain) MineBlock(transactions []*Transaction) *Block {
 		log.Panic(err)
 	}
 
-	newBlock := NewBlock(transactions, lastHash, lastHeight+1)
+	return blocks
+}
 
-	err = bc.db.Update(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte(blocksBucket))
-		err := b.Put(newBlock.Hash, newBlock.Serialize())
-		if err != nil {
-			log.Panic(err)
-		}
+// MineBlock mines a new block with the provided transactions and adds it to the blockchain
+// 交易不能在当前链顶上打包时返回*BlockValidationError；
+// ctx 被取消时（比如链顶已经变化）放弃挖矿并返回 ctx.Err()
+func (bc *Blockchain) MineBlock(ctx context.Context, transactions []*Transaction) (*Block, error) {
+	newBlock, err := bc.SolveBlock(ctx, transactions)
+	if err != nil {
+		return nil, err
+	}
 
-		err = b.Put([]byte("l"), newBlock.Hash)
-		if err != nil {
-			log.Panic(err)
-		}
+	_, err = bc.AddBlock(newBlock)
+	if err != nil {
+		return nil, err
+	}
+	fmt.Println("挖矿成功，最新区块高度为：", newBlock.Height)
 
-		bc.tip = newBlock.Hash
+	return newBlock, nil
+}
 
-		return nil
+// SolveBlock 在当前链顶上生成区块并完成工作量证明，但不加入区块链。
+// 节点挖矿时在持有 lock 的情况下调用 AddBlock，挖矿本身不需要持有 lock
+func (bc *Blockchain) SolveBlock(ctx context.Context, transactions []*Transaction) (*Block, error) {
+	var newBlock *Block
+
+	//挖矿之前先对照UTXO集检查交易，避免在无效的区块上浪费算力
+	err := bc.db.View(func(tx StorageTx) error {
+		b := tx.Bucket([]byte(blocksBucket))
+		lastHash := append([]byte{}, b.Get([]byte("l"))...)
+
+		parent := getBlockIndex(tx, lastHash)
+		newBlock = newBlockTemplate(transactions, lastHash, parent.Height+1, calcNextBits(tx, parent))
+
+		return checkBlockInputs(tx, newBlock)
 	})
 	if err != nil {
-		log.Panic(err)
+		return nil, err
 	}
-	fmt.Println("挖矿成功，最新区块高度为：", newBlock.Height)
-	return newBlock
+
+	miner := NewMiner()
+	err = miner.Mine(ctx, newBlock)
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Printf("算力：%.0f H/s\n", miner.HashRate())
+
+	return newBlock, nil
 }
 
 // SignTransaction signs inputs of a Transaction
@@ -0,0 +1,372 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBlockchainInMemory(t *testing.T) {
+	defer func(old *ChainParams) { activeNetParams = old }(activeNetParams)
+	activeNetParams = &RegTestParams
+
+	alice, bob := NewWallet(), NewWallet()
+	aliceAddress, bobAddress := string(alice.GetAddress()), string(bob.GetAddress())
+
+	//同一个进程中的两条链互不影响
+	bc := CreateBlockchainWithStorage(NewMemoryStorage(), aliceAddress)
+	defer bc.db.Close()
+	other := CreateBlockchainWithStorage(NewMemoryStorage(), bobAddress)
+	defer other.db.Close()
+
+	UTXOSet := UTXOSet{bc}
+
+	tx := NewUTXOTransaction(alice, bobAddress, 4, 1, &UTXOSet)
+	cbTx := NewCoinbaseTX(aliceAddress, "", GetBlockSubsidy(1)+1)
+	block, err := bc.MineBlock(context.Background(), []*Transaction{cbTx, tx})
+	assert.Nil(t, err)
+
+	assert.Equal(t, 1, bc.GetBestHeight())
+	assert.Equal(t, 0, other.GetBestHeight())
+	assert.Equal(t, block.Hash, bc.tip)
+
+	found, err := bc.FindTransaction(tx.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, tx.ID, found.ID)
+	assert.True(t, bc.VerifyTransaction(&found))
+
+	alicePubKeyHash, bobPubKeyHash := HashPubKey(alice.PublicKey), HashPubKey(bob.PublicKey)
+	assert.Equal(t, 2*GetBlockSubsidy(0)-4, bc.GetAddressBalance(alicePubKeyHash))
+	assert.Equal(t, 4, bc.GetAddressBalance(bobPubKeyHash))
+	assert.Equal(t, GetBlockSubsidy(0), other.GetAddressBalance(bobPubKeyHash))
+
+	reloaded := NewBlockchainWithStorage(bc.db)
+	genesis, err := reloaded.GetBlockByHeight(0)
+	assert.Nil(t, err)
+	assert.Equal(t, [][]byte{block.Hash}, reloaded.GetBlockHashes(genesis.Height))
+}
+
+func TestMemoryStorageRollback(t *testing.T) {
+	db := NewMemoryStorage()
+
+	err := db.Update(func(tx StorageTx) error {
+		b, err := tx.CreateBucket([]byte("test"))
+		assert.Nil(t, err)
+		assert.Nil(t, b.Put([]byte("b"), []byte("2")))
+		assert.Nil(t, b.Put([]byte("a"), []byte("1")))
+		return nil
+	})
+	assert.Nil(t, err)
+
+	failed := errors.New("failed")
+	err = db.Update(func(tx StorageTx) error {
+		assert.Nil(t, tx.Bucket([]byte("test")).Put([]byte("c"), []byte("3")))
+		assert.Nil(t, tx.DeleteBucket([]byte("test")))
+		return failed
+	})
+	assert.Equal(t, failed, err)
+
+	//panic时同样回滚，删除后重新创建的表恢复原来的内容
+	assert.Panics(t, func() {
+		db.Update(func(tx StorageTx) error {
+			assert.Nil(t, tx.Bucket([]byte("test")).Delete([]byte("a")))
+			assert.Nil(t, tx.DeleteBucket([]byte("test")))
+			b, err := tx.CreateBucket([]byte("test"))
+			assert.Nil(t, err)
+			assert.Nil(t, b.Put([]byte("z"), []byte("26")))
+			_, err = tx.CreateBucket([]byte("missing"))
+			assert.Nil(t, err)
+			panic(failed)
+		})
+	})
+
+	err = db.View(func(tx StorageTx) error {
+		var keys []string
+		c := tx.Bucket([]byte("test")).Cursor()
+		for k, _ := c.First(); k != nil; k, _ = c.Next() {
+			keys = append(keys, string(k))
+		}
+		assert.Equal(t, []string{"a", "b"}, keys)
+		assert.Equal(t, []byte("1"), tx.Bucket([]byte("test")).Get([]byte("a")))
+		assert.Nil(t, tx.Bucket([]byte("missing")))
+		return nil
+	})
+	assert.Nil(t, err)
+}
+
+func TestOldDatabaseFormat(t *testing.T) {
+	defer func(old *ChainParams) { activeNetParams = old }(activeNetParams)
+	activeNetParams = &RegTestParams
+
+	wallet := NewWallet()
+	bc := CreateBlockchainWithStorage(NewMemoryStorage(), string(wallet.GetAddress()))
+	defer bc.db.Close()
+	assert.Nil(t, checkDBFormat(bc.db))
+
+	//没有版本号的数据库中，当前格式的区块可以解码，gob编码的旧区块不能
+	err := bc.db.Update(func(tx StorageTx) error {
+		return tx.Bucket([]byte(blocksBucket)).Delete([]byte("v"))
+	})
+	assert.Nil(t, err)
+	assert.Nil(t, checkDBFormat(bc.db))
+
+	//版本1的地址索引被删除，打开时重建
+	err = bc.db.Update(func(tx StorageTx) error {
+		return tx.Bucket([]byte(blocksBucket)).Put([]byte("v"), []byte{1})
+	})
+	assert.Nil(t, err)
+	assert.Nil(t, checkDBFormat(bc.db))
+	bc.db.View(func(tx StorageTx) error {
+		assert.Nil(t, tx.Bucket([]byte(addrIndexBucket)))
+		return nil
+	})
+	reloaded := NewBlockchainWithStorage(bc.db)
+	assert.Equal(t, GetBlockSubsidy(0), reloaded.GetAddressBalance(HashPubKey(wallet.PublicKey)))
+
+	err = bc.db.Update(func(tx StorageTx) error {
+		b := tx.Bucket([]byte(blocksBucket))
+		b.Delete([]byte("v"))
+		return b.Put(bc.tip, gobEncode(Block{Hash: bc.tip}))
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, ErrOldDatabase, checkDBFormat(bc.db))
+}
+
+// addTestBlock 在parent上创建一个区块并加入区块链
+func addTestBlock(bc *Blockchain, parent *Block, txs ...*Transaction) (*Block, []Transaction, error) {
+	if len(txs) == 0 || !txs[0].IsCoinbase() {
+		txs = append([]*Transaction{NewCoinbaseTX(string(NewWallet().GetAddress()), "", GetBlockSubsidy(parent.Height+1))}, txs...)
+	}
+	block := NewBlock(txs, parent.Hash, parent.Height+1, RegTestParams.PowLimitBits)
+	disconnected, err := bc.AddBlock(block)
+
+	return block, disconnected, err
+}
+
+// dumpBucket 返回表中所有的键值，UTXO用gob编码，map的编码顺序不固定，所以比较解码后的内容
+func dumpBucket(bc *Blockchain, bucket string) map[string]string {
+	dump := make(map[string]string)
+
+	err := bc.db.View(func(tx StorageTx) error {
+		c := tx.Bucket([]byte(bucket)).Cursor()
+		for k, v := c.First(); k != nil; k, v = c.Next() {
+			if bucket == utxoBucket {
+				dump[hex.EncodeToString(k)] = fmt.Sprint(DeserializeOutputs(v))
+			} else {
+				dump[hex.EncodeToString(k)] = hex.EncodeToString(v)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	return dump
+}
+
+// assertChainState 检查UTXO集和重建的结果一致，地址索引中的余额和UTXO集一致
+func assertChainState(t *testing.T, bc *Blockchain, wallets ...*Wallet) {
+	UTXOSet := UTXOSet{bc}
+	utxos := dumpBucket(bc, utxoBucket)
+	UTXOSet.Reindex()
+	assert.Equal(t, utxos, dumpBucket(bc, utxoBucket))
+
+	for _, wallet := range wallets {
+		pubKeyHash := HashPubKey(wallet.PublicKey)
+		balance := 0
+		for _, out := range UTXOSet.FindUTXO(pubKeyHash) {
+			balance += out.Value
+		}
+		assert.Equal(t, balance, bc.GetAddressBalance(pubKeyHash))
+	}
+}
+
+func TestReorganize(t *testing.T) {
+	defer func(old *ChainParams) { activeNetParams = old }(activeNetParams)
+	activeNetParams = &RegTestParams
+
+	alice, carol := NewWallet(), NewWallet()
+	aliceAddress, carolAddress := string(alice.GetAddress()), string(carol.GetAddress())
+	bc := CreateBlockchainWithStorage(NewMemoryStorage(), aliceAddress)
+	defer bc.db.Close()
+	UTXOSet := UTXOSet{bc}
+	genesis, err := bc.GetBlockByHeight(0)
+	assert.Nil(t, err)
+
+	tx := NewUTXOTransaction(alice, carolAddress, 4, 0, &UTXOSet)
+	a1, _, err := addTestBlock(bc, &genesis, tx)
+	assert.Nil(t, err)
+	assert.Equal(t, 4, bc.GetAddressBalance(HashPubKey(carol.PublicKey)))
+
+	//累计工作量相同的分支不切换主链，更重的分支切换主链，断开的交易被返回
+	b1, disconnected, err := addTestBlock(bc, &genesis)
+	assert.Nil(t, err)
+	assert.Empty(t, disconnected)
+	assert.Equal(t, a1.Hash, bc.tip)
+	b2, disconnected, err := addTestBlock(bc, b1)
+	assert.Nil(t, err)
+	assert.Equal(t, b2.Hash, bc.tip)
+	assert.Len(t, disconnected, 1)
+	assert.Equal(t, tx.ID, disconnected[0].ID)
+	assert.Equal(t, 0, bc.GetAddressBalance(HashPubKey(carol.PublicKey)))
+	assert.Equal(t, GetBlockSubsidy(0), bc.GetAddressBalance(HashPubKey(alice.PublicKey)))
+	assertChainState(t, bc, alice, carol)
+
+	//切换回原来的分支，交易重新生效
+	a2, _, err := addTestBlock(bc, a1)
+	assert.Nil(t, err)
+	assert.Equal(t, b2.Hash, bc.tip)
+	a3, disconnected, err := addTestBlock(bc, a2)
+	assert.Nil(t, err)
+	assert.Equal(t, a3.Hash, bc.tip)
+	assert.Empty(t, disconnected)
+	assert.Equal(t, 4, bc.GetAddressBalance(HashPubKey(carol.PublicKey)))
+	assertChainState(t, bc, alice, carol)
+
+	//孤块先于父区块到达，父区块到达后一起接上
+	a4 := NewBlock([]*Transaction{NewCoinbaseTX(aliceAddress, "", GetBlockSubsidy(4))}, a3.Hash, 4, RegTestParams.PowLimitBits)
+	a5, _, err := addTestBlock(bc, a4)
+	assert.Equal(t, ErrOrphanBlock, err)
+	assert.Equal(t, a3.Hash, bc.tip)
+	_, err = bc.AddBlock(a4)
+	assert.Nil(t, err)
+	assert.Equal(t, a5.Hash, bc.tip)
+	assert.Equal(t, GetBlockSubsidy(0)-4+GetBlockSubsidy(4), bc.GetAddressBalance(HashPubKey(alice.PublicKey)))
+	assertChainState(t, bc, alice, carol)
+
+	//侧链上的区块在切换主链时才检查输入，coinbase金额过大的分支被拒绝，主链不变
+	tooMuch := NewCoinbaseTX(carolAddress, "", GetBlockSubsidy(5)+1)
+	c5, _, err := addTestBlock(bc, a4, tooMuch)
+	assert.Nil(t, err)
+	assert.Equal(t, a5.Hash, bc.tip)
+	_, _, err = addTestBlock(bc, c5)
+	assert.IsType(t, &BlockValidationError{}, err)
+	assert.Equal(t, a5.Hash, bc.tip)
+	assert.Equal(t, 4, bc.GetAddressBalance(HashPubKey(carol.PublicKey)))
+	assertChainState(t, bc, alice, carol)
+}
+
+// assertMainChain 检查高度索引按顺序指向给定的区块
+func assertMainChain(t *testing.T, bc *Blockchain, blocks ...*Block) {
+	var hashes [][]byte
+
+	for height, block := range blocks {
+		found, err := bc.GetBlockByHeight(height)
+		assert.Nil(t, err)
+		assert.Equal(t, block.Hash, found.Hash)
+		hashes = append(hashes, block.Hash)
+	}
+	_, err := bc.GetBlockByHeight(len(blocks))
+	assert.NotNil(t, err)
+	assert.Equal(t, hashes[1:], bc.GetBlockHashes(0))
+	assert.Equal(t, len(blocks)-1, bc.GetBestHeight())
+}
+
+func TestHeightIndexReorganize(t *testing.T) {
+	defer func(old *ChainParams) { activeNetParams = old }(activeNetParams)
+	activeNetParams = &RegTestParams
+
+	bc := CreateBlockchainWithStorage(NewMemoryStorage(), string(NewWallet().GetAddress()))
+	defer bc.db.Close()
+	genesis, err := bc.GetBlockByHeight(0)
+	assert.Nil(t, err)
+
+	a1, _, err := addTestBlock(bc, &genesis)
+	assert.Nil(t, err)
+	a2, _, err := addTestBlock(bc, a1)
+	assert.Nil(t, err)
+	assertMainChain(t, bc, &genesis, a1, a2)
+
+	//更长的分支成为主链，原来的高度指向新分支上的区块
+	b1, _, err := addTestBlock(bc, &genesis)
+	assert.Nil(t, err)
+	b2, _, err := addTestBlock(bc, b1)
+	assert.Nil(t, err)
+	assertMainChain(t, bc, &genesis, a1, a2)
+	b3, _, err := addTestBlock(bc, b2)
+	assert.Nil(t, err)
+	assertMainChain(t, bc, &genesis, b1, b2, b3)
+
+	a3, _, err := addTestBlock(bc, a2)
+	assert.Nil(t, err)
+	a4, _, err := addTestBlock(bc, a3)
+	assert.Nil(t, err)
+	assertMainChain(t, bc, &genesis, a1, a2, a3, a4)
+}
+
+func TestTxIndexReorganize(t *testing.T) {
+	defer func(old *ChainParams) { activeNetParams = old }(activeNetParams)
+	activeNetParams = &RegTestParams
+
+	alice := NewWallet()
+	aliceAddress := string(alice.GetAddress())
+	bc := CreateBlockchainWithStorage(NewMemoryStorage(), aliceAddress)
+	defer bc.db.Close()
+	UTXOSet := UTXOSet{bc}
+	genesis, err := bc.GetBlockByHeight(0)
+	assert.Nil(t, err)
+	assert.False(t, bc.TxIndexEnabled())
+	assert.Equal(t, 1, bc.ReindexTransactions())
+	assert.True(t, bc.TxIndexEnabled())
+
+	tx := NewUTXOTransaction(alice, string(NewWallet().GetAddress()), 4, 0, &UTXOSet)
+	a1, _, err := addTestBlock(bc, &genesis, tx)
+	assert.Nil(t, err)
+	found, err := bc.FindTransaction(tx.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, tx.ID, found.ID)
+
+	//交易所在的区块断开后从索引中删除，侧链上的交易查不到
+	b1, _, err := addTestBlock(bc, &genesis)
+	assert.Nil(t, err)
+	b2, _, err := addTestBlock(bc, b1)
+	assert.Nil(t, err)
+	_, err = bc.FindTransaction(tx.ID)
+	assert.NotNil(t, err)
+	found, err = bc.FindTransaction(b2.Transactions[0].ID)
+	assert.Nil(t, err)
+	assert.Equal(t, b2.Transactions[0].ID, found.ID)
+
+	//切换回来后交易重新加入索引，和重建的索引一致
+	a2, _, err := addTestBlock(bc, a1)
+	assert.Nil(t, err)
+	_, _, err = addTestBlock(bc, a2)
+	assert.Nil(t, err)
+	found, err = bc.FindTransaction(tx.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, tx.ID, found.ID)
+	_, err = bc.FindTransaction(b1.Transactions[0].ID)
+	assert.NotNil(t, err)
+
+	txindex := dumpBucket(bc, txIndexBucket)
+	assert.Equal(t, 5, bc.ReindexTransactions())
+	assert.Equal(t, txindex, dumpBucket(bc, txIndexBucket))
+}
+
+func TestAddressIndexPrefix(t *testing.T) {
+	defer func(old *ChainParams) { activeNetParams = old }(activeNetParams)
+	activeNetParams = &RegTestParams
+
+	bc := CreateBlockchainWithStorage(NewMemoryStorage(), string(NewWallet().GetAddress()))
+	defer bc.db.Close()
+	genesis, err := bc.GetBlockByHeight(0)
+	assert.Nil(t, err)
+
+	//一个公钥Hash是另一个的前缀
+	short := []byte("pubKeyHash")
+	long := append([]byte("pubKeyHash"), 0)
+	coinbase := NewCoinbaseTX(string(NewWallet().GetAddress()), "", 0)
+	coinbase.Vout = []TXOutput{{1, short}, {2, long}}
+	coinbase.ID = coinbase.unsignedHash()
+	_, _, err = addTestBlock(bc, &genesis, coinbase)
+	assert.Nil(t, err)
+
+	assert.Equal(t, 1, bc.GetAddressBalance(short))
+	assert.Equal(t, 2, bc.GetAddressBalance(long))
+	assert.Len(t, bc.GetAddressHistory(short), 1)
+}
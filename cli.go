@@ -13,14 +13,34 @@ type CLI struct{}
 
 func (cli *CLI) printUsage() {
 	fmt.Println("Usage:")
+	fmt.Println("  changepassphrase - Change the passphrase of the encrypted wallet")
 	fmt.Println("  createblockchain -Address ADDRESS - Create a blockchain and send genesis block reward to ADDRESS")
-	fmt.Println("  createwallet - Generates a new key-pair and saves it into the wallet file")
+	fmt.Println("  createrawtx -from FROM -to TO -amount AMOUNT -fee FEE [-out FILE] - Create an unsigned transaction for signing offline with signrawtx")
+	fmt.Println("  createwallet [-type base58|bech32] [-hd] - Generates a new key-pair and saves it into the wallet file. -hd derives keys from a recovery phrase")
+	fmt.Println("  dumpprivkey -Address ADDRESS - Print the private key of ADDRESS so it can be imported elsewhere")
+	fmt.Println("  encryptwallet - Encrypt the private keys in the wallet file with a new passphrase")
 	fmt.Println("  getbalance -Address ADDRESS - Get balance of ADDRESS")
+	fmt.Println("  getblock -height HEIGHT - Print the main chain block at HEIGHT")
+	fmt.Println("  getsupply - Print the number of coins issued up to the current tip")
+	fmt.Println("  importaddress -Address ADDRESS [-rescan=false] - Watch ADDRESS without its private key and list its transactions and balance")
+	fmt.Println("  importprivkey -privkey KEY [-type base58|bech32] [-rescan=false] - Add a private key printed by dumpprivkey to the wallet and list its transactions and balance")
 	fmt.Println("  listaddresses - Lists all addresses from the wallet file")
+	fmt.Println("  listtransactions -Address ADDRESS - List the transactions that pay to or spend from ADDRESS")
 	fmt.Println("  printchain - Print all the blocks of the blockchain")
 	fmt.Println("  reindexutxo - Rebuilds the UTXO set")
-	fmt.Println("  send -from FROM -to TO -amount AMOUNT -mine - Send AMOUNT of coins from FROM Address to TO. Mine on the same node, when -mine is set.")
-	fmt.Println("  startnode -mine - Start a node  -mine enables Mining")
+	fmt.Println("  reindextx - Rebuilds the transaction index and enables it")
+	fmt.Println("  restorewallet -mnemonic WORDS [-type base58|bech32] [-gap N] - Restore an HD wallet from its recovery phrase")
+	fmt.Println("  sendmany -from FROM (-to ADDRESS:AMOUNT,... | -file FILE) -fee FEE -mine - Pay many addresses in one transaction. FILE is a JSON list of {\"address\", \"amount\"} objects")
+	fmt.Println("  sendrawtx -in FILE [-mine -miner ADDRESS] - Send a transaction signed with signrawtx. Mine on the same node, when -mine is set.")
+	fmt.Println("  send -from FROM -to TO -amount AMOUNT -fee FEE -mine [-coinselect first|largest|bnb|random] [-include TXID:VOUT,...] [-exclude TXID:VOUT,...] - Send AMOUNT of coins from FROM Address to TO, paying FEE to the miner. Mine on the same node, when -mine is set. -include and -exclude pin or skip outputs")
+	fmt.Println("  signrawtx -in FILE [-out FILE] - Sign the inputs of an unsigned transaction with the keys in the wallet file, without the blockchain")
+	fmt.Println("  startnode -mine -miner ADDRESS -txindex - Start a node  -mine enables Mining, rewards are sent to ADDRESS. -txindex enables the transaction index")
+	fmt.Println("  walletlock - Lock the wallet unlocked by walletpassphrase")
+	fmt.Println("  walletpassphrase -timeout SECONDS - Unlock the encrypted wallet for SECONDS")
+	fmt.Println("All commands accept -datadir DIR to keep the blockchain, wallets and peers in DIR (default: current directory)")
+	fmt.Println("and -network NAME to select mainnet, testnet or regtest (default: mainnet)")
+	fmt.Println("Passphrases are read from the terminal or standard input. Commands that use the private keys of an")
+	fmt.Println("encrypted wallet ask for its passphrase unless it is unlocked, the unlocked keys are never written to disk")
 }
 
 func (cli *CLI) validateArgs() {
@@ -34,44 +54,151 @@ func (cli *CLI) validateArgs() {
 func (cli *CLI) Run() {
 	cli.validateArgs()
 
+	changePassphraseCmd := flag.NewFlagSet("changepassphrase", flag.ExitOnError)
+	dumpPrivKeyCmd := flag.NewFlagSet("dumpprivkey", flag.ExitOnError)
+	encryptWalletCmd := flag.NewFlagSet("encryptwallet", flag.ExitOnError)
 	getBalanceCmd := flag.NewFlagSet("getbalance", flag.ExitOnError)
+	getBlockCmd := flag.NewFlagSet("getblock", flag.ExitOnError)
+	getSupplyCmd := flag.NewFlagSet("getsupply", flag.ExitOnError)
 	createBlockchainCmd := flag.NewFlagSet("createblockchain", flag.ExitOnError)
+	createRawTxCmd := flag.NewFlagSet("createrawtx", flag.ExitOnError)
 	createWalletCmd := flag.NewFlagSet("createwallet", flag.ExitOnError)
+	importAddressCmd := flag.NewFlagSet("importaddress", flag.ExitOnError)
+	importPrivKeyCmd := flag.NewFlagSet("importprivkey", flag.ExitOnError)
 	listAddressesCmd := flag.NewFlagSet("listaddresses", flag.ExitOnError)
+	listTransactionsCmd := flag.NewFlagSet("listtransactions", flag.ExitOnError)
 	printChainCmd := flag.NewFlagSet("printchain", flag.ExitOnError)
 	reindexUTXOCmd := flag.NewFlagSet("reindexutxo", flag.ExitOnError)
+	reindexTxCmd := flag.NewFlagSet("reindextx", flag.ExitOnError)
+	restoreWalletCmd := flag.NewFlagSet("restorewallet", flag.ExitOnError)
 	sendCmd := flag.NewFlagSet("send", flag.ExitOnError)
+	sendManyCmd := flag.NewFlagSet("sendmany", flag.ExitOnError)
+	sendRawTxCmd := flag.NewFlagSet("sendrawtx", flag.ExitOnError)
+	signRawTxCmd := flag.NewFlagSet("signrawtx", flag.ExitOnError)
 	startNodeCmd := flag.NewFlagSet("startnode", flag.ExitOnError)
+	walletAgentCmd := flag.NewFlagSet(walletAgentCommand, flag.ExitOnError)
+	walletLockCmd := flag.NewFlagSet("walletlock", flag.ExitOnError)
+	walletPassphraseCmd := flag.NewFlagSet("walletpassphrase", flag.ExitOnError)
 
+	var network string
+	for _, cmd := range []*flag.FlagSet{changePassphraseCmd, dumpPrivKeyCmd, encryptWalletCmd, getBalanceCmd, getBlockCmd,
+		getSupplyCmd, createBlockchainCmd, createRawTxCmd, createWalletCmd, importAddressCmd, importPrivKeyCmd,
+		listAddressesCmd, listTransactionsCmd, printChainCmd, reindexUTXOCmd, reindexTxCmd, restoreWalletCmd, sendCmd,
+		sendManyCmd, sendRawTxCmd, signRawTxCmd, startNodeCmd, walletAgentCmd, walletLockCmd, walletPassphraseCmd} {
+		cmd.StringVar(&dataDir, "datadir", ".", "Directory to keep the blockchain, wallets and peers in")
+		cmd.StringVar(&network, "network", MainNetParams.Name, "Network to use: mainnet, testnet or regtest")
+	}
+
+	dumpPrivKeyAddress := dumpPrivKeyCmd.String("Address", "", "The Address to print the private key of")
 	getBalanceAddress := getBalanceCmd.String("Address", "", "The Address to get balance for")
+	getBlockHeight := getBlockCmd.Int("height", -1, "The height of the block")
+	importAddressAddress := importAddressCmd.String("Address", "", "The Address to watch")
+	importAddressRescan := importAddressCmd.Bool("rescan", true, "List the transactions and balance of the Address from the address index")
+	importPrivKey := importPrivKeyCmd.String("privkey", "", "The private key printed by dumpprivkey")
+	importPrivKeyType := importPrivKeyCmd.String("type", addressTypeBase58, "Address format of the imported key: base58 or bech32")
+	importPrivKeyRescan := importPrivKeyCmd.Bool("rescan", true, "List the transactions and balance of the Address from the address index")
+	listTransactionsAddress := listTransactionsCmd.String("Address", "", "The Address to list transactions for")
 	createBlockchainAddress := createBlockchainCmd.String("Address", "", "The Address to send genesis block reward to")
+	createRawTxFrom := createRawTxCmd.String("from", "", "Source wallet Address, may be watch-only")
+	createRawTxTo := createRawTxCmd.String("to", "", "Destination wallet Address")
+	createRawTxAmount := createRawTxCmd.Int("amount", 0, "Amount to send")
+	createRawTxFee := createRawTxCmd.Int("fee", 0, "Transaction fee paid to the miner")
+	createRawTxOut := createRawTxCmd.String("out", "", "File to write the unsigned transaction to, printed when empty")
+	createWalletType := createWalletCmd.String("type", addressTypeBase58, "Address format of the new wallet: base58 or bech32")
+	createWalletHD := createWalletCmd.Bool("hd", false, "Derive the key from an HD seed, creating a recovery phrase if the wallet has none")
+	restoreWalletMnemonic := restoreWalletCmd.String("mnemonic", "", "The recovery phrase of the wallet")
+	restoreWalletType := restoreWalletCmd.String("type", addressTypeBase58, "Address format of the restored wallet: base58 or bech32")
+	restoreWalletGap := restoreWalletCmd.Int("gap", hdGapLimit, "Stop looking for used addresses after N unused ones in a row")
 	sendFrom := sendCmd.String("from", "", "Source wallet Address")
 	sendTo := sendCmd.String("to", "", "Destination wallet Address")
 	sendAmount := sendCmd.Int("amount", 0, "Amount to send")
+	sendFee := sendCmd.Int("fee", 0, "Transaction fee paid to the miner")
 	sendMine := sendCmd.Bool("mine", false, "Mine immediately on the same node")
+	sendCoinSelect := sendCmd.String("coinselect", "first", "Coin selection strategy: first, largest, bnb or random")
+	sendInclude := sendCmd.String("include", "", "Comma separated TXID:VOUT outputs that must be spent")
+	sendExclude := sendCmd.String("exclude", "", "Comma separated TXID:VOUT outputs that must not be spent")
+	sendManyFrom := sendManyCmd.String("from", "", "Source wallet Address")
+	sendManyTo := sendManyCmd.String("to", "", "Comma separated ADDRESS:AMOUNT payments")
+	sendManyFile := sendManyCmd.String("file", "", "JSON file with the payments")
+	sendManyFee := sendManyCmd.Int("fee", 0, "Transaction fee paid to the miner")
+	sendManyMine := sendManyCmd.Bool("mine", false, "Mine immediately on the same node")
+	sendRawTxIn := sendRawTxCmd.String("in", "", "File holding the signed transaction")
+	sendRawTxMine := sendRawTxCmd.Bool("mine", false, "Mine immediately on the same node")
+	sendRawTxMiner := sendRawTxCmd.String("miner", "", "Address to send the Mining reward to, when -mine is set")
+	signRawTxIn := signRawTxCmd.String("in", "", "File holding the unsigned transaction")
+	signRawTxOut := signRawTxCmd.String("out", "", "File to write the signed transaction to, printed when empty")
 	startNodeMine := startNodeCmd.Bool("mine", false, "Enable Mining mode")
+	startNodeMiner := startNodeCmd.String("miner", "", "Address to send Mining rewards to")
+	startNodeTxIndex := startNodeCmd.Bool("txindex", false, "Maintain an index of all transactions in the blockchain")
+	walletAgentTimeout := walletAgentCmd.Int("timeout", 0, "Seconds to keep the wallet unlocked")
+	walletPassphraseTimeout := walletPassphraseCmd.Int("timeout", 0, "Seconds to keep the wallet unlocked")
 
 	switch os.Args[1] {
+	case "changepassphrase":
+		err := changePassphraseCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "dumpprivkey":
+		err := dumpPrivKeyCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "encryptwallet":
+		err := encryptWalletCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
 	case "getbalance":
 		err := getBalanceCmd.Parse(os.Args[2:])
 		if err != nil {
 			log.Panic(err)
 		}
+	case "getblock":
+		err := getBlockCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "getsupply":
+		err := getSupplyCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
 	case "createblockchain":
 		err := createBlockchainCmd.Parse(os.Args[2:])
 		if err != nil {
 			log.Panic(err)
 		}
+	case "createrawtx":
+		err := createRawTxCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
 	case "createwallet":
 		err := createWalletCmd.Parse(os.Args[2:])
 		if err != nil {
 			log.Panic(err)
 		}
+	case "importaddress":
+		err := importAddressCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "importprivkey":
+		err := importPrivKeyCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
 	case "listaddresses":
 		err := listAddressesCmd.Parse(os.Args[2:])
 		if err != nil {
 			log.Panic(err)
 		}
+	case "listtransactions":
+		err := listTransactionsCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
 	case "printchain":
 		err := printChainCmd.Parse(os.Args[2:])
 		if err != nil {
@@ -82,21 +209,101 @@ func (cli *CLI) Run() {
 		if err != nil {
 			log.Panic(err)
 		}
+	case "reindextx":
+		err := reindexTxCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "restorewallet":
+		err := restoreWalletCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
 	case "send":
 		err := sendCmd.Parse(os.Args[2:])
 		if err != nil {
 			log.Panic(err)
 		}
+	case "sendmany":
+		err := sendManyCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "sendrawtx":
+		err := sendRawTxCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "signrawtx":
+		err := signRawTxCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
 	case "startnode":
 		err := startNodeCmd.Parse(os.Args[2:])
 		if err != nil {
 			log.Panic(err)
 		}
+	case walletAgentCommand:
+		err := walletAgentCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "walletlock":
+		err := walletLockCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "walletpassphrase":
+		err := walletPassphraseCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
 	default:
 		cli.printUsage()
 		os.Exit(1)
 	}
 
+	err := selectNetwork(network)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	//解锁代理不打开区块链和钱包，不锁数据目录，否则它运行期间其他命令都无法执行
+	if walletAgentCmd.Parsed() {
+		err = runWalletAgent(*walletAgentTimeout)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	//锁住数据目录，防止两个进程同时打开同一条链
+	dirLock, err := lockNetworkDir()
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	defer dirLock.Close()
+
+	if changePassphraseCmd.Parsed() {
+		cli.changePassphrase()
+	}
+
+	if dumpPrivKeyCmd.Parsed() {
+		if *dumpPrivKeyAddress == "" {
+			dumpPrivKeyCmd.Usage()
+			os.Exit(1)
+		}
+		cli.dumpPrivKey(*dumpPrivKeyAddress)
+	}
+
+	if encryptWalletCmd.Parsed() {
+		cli.encryptWallet()
+	}
+
 	if getBalanceCmd.Parsed() {
 		if *getBalanceAddress == "" {
 			getBalanceCmd.Usage()
@@ -105,6 +312,18 @@ func (cli *CLI) Run() {
 		cli.getBalance(*getBalanceAddress)
 	}
 
+	if getBlockCmd.Parsed() {
+		if *getBlockHeight < 0 {
+			getBlockCmd.Usage()
+			os.Exit(1)
+		}
+		cli.getBlock(*getBlockHeight)
+	}
+
+	if getSupplyCmd.Parsed() {
+		cli.getSupply()
+	}
+
 	if createBlockchainCmd.Parsed() {
 		if *createBlockchainAddress == "" {
 			createBlockchainCmd.Usage()
@@ -113,14 +332,50 @@ func (cli *CLI) Run() {
 		cli.createBlockchain(*createBlockchainAddress)
 	}
 
+	if createRawTxCmd.Parsed() {
+		if *createRawTxFrom == "" || *createRawTxTo == "" || *createRawTxAmount <= 0 || *createRawTxFee < 0 {
+			createRawTxCmd.Usage()
+			os.Exit(1)
+		}
+		cli.createRawTx(*createRawTxFrom, *createRawTxTo, *createRawTxAmount, *createRawTxFee, *createRawTxOut)
+	}
+
 	if createWalletCmd.Parsed() {
-		cli.createWallet()
+		if *createWalletType != addressTypeBase58 && *createWalletType != addressTypeBech32 {
+			createWalletCmd.Usage()
+			os.Exit(1)
+		}
+		cli.createWallet(*createWalletType, *createWalletHD)
+	}
+
+	if importAddressCmd.Parsed() {
+		if *importAddressAddress == "" {
+			importAddressCmd.Usage()
+			os.Exit(1)
+		}
+		cli.importAddress(*importAddressAddress, *importAddressRescan)
+	}
+
+	if importPrivKeyCmd.Parsed() {
+		if *importPrivKey == "" || (*importPrivKeyType != addressTypeBase58 && *importPrivKeyType != addressTypeBech32) {
+			importPrivKeyCmd.Usage()
+			os.Exit(1)
+		}
+		cli.importPrivKey(*importPrivKey, *importPrivKeyType, *importPrivKeyRescan)
 	}
 
 	if listAddressesCmd.Parsed() {
 		cli.listAddresses()
 	}
 
+	if listTransactionsCmd.Parsed() {
+		if *listTransactionsAddress == "" {
+			listTransactionsCmd.Usage()
+			os.Exit(1)
+		}
+		cli.listTransactions(*listTransactionsAddress)
+	}
+
 	if printChainCmd.Parsed() {
 		cli.printChain()
 	}
@@ -129,16 +384,77 @@ func (cli *CLI) Run() {
 		cli.reindexUTXO()
 	}
 
+	if reindexTxCmd.Parsed() {
+		cli.reindexTx()
+	}
+
+	if restoreWalletCmd.Parsed() {
+		if *restoreWalletMnemonic == "" || *restoreWalletGap <= 0 ||
+			(*restoreWalletType != addressTypeBase58 && *restoreWalletType != addressTypeBech32) {
+			restoreWalletCmd.Usage()
+			os.Exit(1)
+		}
+		cli.restoreWallet(*restoreWalletMnemonic, *restoreWalletType, *restoreWalletGap)
+	}
+
 	if sendCmd.Parsed() {
-		if *sendFrom == "" || *sendTo == "" || *sendAmount <= 0 {
+		if *sendFrom == "" || *sendTo == "" || *sendAmount <= 0 || *sendFee < 0 {
 			sendCmd.Usage()
 			os.Exit(1)
 		}
 
-		cli.send(*sendFrom, *sendTo, *sendAmount, *sendMine)
+		coinControl, err := newCoinControl(*sendCoinSelect, *sendInclude, *sendExclude)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		cli.send(*sendFrom, *sendTo, *sendAmount, *sendFee, *sendMine, coinControl)
+	}
+
+	if sendManyCmd.Parsed() {
+		if *sendManyFrom == "" || (*sendManyTo == "") == (*sendManyFile == "") || *sendManyFee < 0 {
+			sendManyCmd.Usage()
+			os.Exit(1)
+		}
+
+		cli.sendMany(*sendManyFrom, *sendManyTo, *sendManyFile, *sendManyFee, *sendManyMine)
+	}
+
+	if sendRawTxCmd.Parsed() {
+		if *sendRawTxIn == "" || (*sendRawTxMine && !ValidateAddress(*sendRawTxMiner)) {
+			sendRawTxCmd.Usage()
+			os.Exit(1)
+		}
+		cli.sendRawTx(*sendRawTxIn, *sendRawTxMine, *sendRawTxMiner)
+	}
+
+	if signRawTxCmd.Parsed() {
+		if *signRawTxIn == "" {
+			signRawTxCmd.Usage()
+			os.Exit(1)
+		}
+		cli.signRawTx(*signRawTxIn, *signRawTxOut)
 	}
 
 	if startNodeCmd.Parsed() {
-		cli.startNode(*startNodeMine)
+		if *startNodeMine && *startNodeMiner == "" {
+			fmt.Println("Mining is enabled but no -miner Address is given")
+			startNodeCmd.Usage()
+			os.Exit(1)
+		}
+		cli.startNode(*startNodeMine, *startNodeMiner, *startNodeTxIndex)
+	}
+
+	if walletLockCmd.Parsed() {
+		cli.walletLock()
+	}
+
+	if walletPassphraseCmd.Parsed() {
+		if *walletPassphraseTimeout <= 0 {
+			walletPassphraseCmd.Usage()
+			os.Exit(1)
+		}
+		cli.walletPassphrase(*walletPassphraseTimeout)
 	}
 }
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+func (cli *CLI) changePassphrase() {
+	wallets, err := NewWallets()
+	if err != nil {
+		fmt.Println("There are not any wallet,Please create one first.")
+		os.Exit(1)
+	}
+	if !wallets.IsEncrypted() {
+		fmt.Println("wallet is not encrypted, use encryptwallet first")
+		os.Exit(1)
+	}
+
+	oldPassphrase := readPassphrase("Current passphrase: ")
+	err = wallets.ChangePassphrase(oldPassphrase, readNewPassphrase())
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	wallets.SaveToFile()
+
+	fmt.Println("Wallet passphrase changed")
+}
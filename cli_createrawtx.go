@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+)
+
+func (cli *CLI) createRawTx(from, to string, amount, fee int, out string) {
+	if !ValidateAddress(from) {
+		log.Panic("ERROR: Sender Address is not valid")
+	}
+	if !ValidateAddress(to) {
+		log.Panic("ERROR: Recipient Address is not valid")
+	}
+
+	bc := NewBlockchain()
+	UTXOSet := UTXOSet{bc}
+	defer bc.db.Close()
+
+	rtx, err := NewRawTransaction(from, to, amount, fee, &UTXOSet)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	printRawTx(rtx)
+	writeRawTx(out, rtx)
+}
+
+// readRawTx 读取文件中十六进制编码的未签名交易
+func readRawTx(path string) *RawTransaction {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	data, err := hex.DecodeString(strings.TrimSpace(string(content)))
+	if err != nil {
+		fmt.Println("Invalid raw transaction:", err)
+		os.Exit(1)
+	}
+
+	rtx, err := DeserializeRawTransaction(data)
+	if err != nil {
+		fmt.Println("Invalid raw transaction:", err)
+		os.Exit(1)
+	}
+
+	return rtx
+}
+
+// writeRawTx 把未签名交易以十六进制写入文件，path 为空时打印出来
+func writeRawTx(path string, rtx *RawTransaction) {
+	encoded := hex.EncodeToString(rtx.Serialize())
+	if path == "" {
+		fmt.Println(encoded)
+		return
+	}
+
+	err := ioutil.WriteFile(path, []byte(encoded+"\n"), 0644)
+	if err != nil {
+		log.Panic(err)
+	}
+	fmt.Printf("Raw transaction written to %s\n", path)
+}
+
+// printRawTx 打印交易的输入、输出和交易费，签名前应该核对这些内容
+func printRawTx(rtx *RawTransaction) {
+	for i, vin := range rtx.Tx.Vin {
+		spent := rtx.Spent[i]
+		fmt.Printf("Input %d: %x:%d  %s  %d\n", i, vin.Txid, vin.Vout, formatPubKeyHash(spent.PubKeyHash), spent.Value)
+	}
+	for i, out := range rtx.Tx.Vout {
+		fmt.Printf("Output %d: %s  %d\n", i, formatPubKeyHash(out.PubKeyHash), out.Value)
+	}
+	fmt.Printf("Fee: %d\n", rtx.Fee())
+	fmt.Printf("Signed inputs: %d of %d\n", rtx.SignedInputs(), len(rtx.Tx.Vin))
+}
+
+// formatPubKeyHash 输出中只有公钥Hash，不知道收款人用的是哪种地址格式，所以两种格式都打印
+func formatPubKeyHash(pubKeyHash []byte) string {
+	return fmt.Sprintf("%s (%s)", Base58CheckEncode(activeNetParams.AddressVersion, pubKeyHash), encodeBech32Address(pubKeyHash))
+}
@@ -1,10 +1,42 @@
 package main
 
-import "fmt"
+import (
+	"fmt"
+	"os"
+)
 
-func (cli *CLI) createWallet() {
+// createWallet 创建一个新地址，hd 为 true 且钱包还没有HD种子时先生成助记词
+func (cli *CLI) createWallet(addressType string, hd bool) {
 	wallets, _ := NewWallets()
-	address := wallets.CreateWallet()
+	unlockWallets(wallets)
+
+	if hd && wallets.HDChain == nil {
+		mnemonic, err := newMnemonic()
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		seed, err := mnemonicToSeed(mnemonic)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		err = wallets.SetHDSeed(seed)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		fmt.Printf("Your recovery phrase: %s\n", mnemonic)
+		fmt.Println("Write it down and keep it safe, it restores all derived addresses of this wallet with restorewallet.")
+		fmt.Println("Keys added later with importprivkey are not derived from it and need their own backup.")
+	}
+
+	address, err := wallets.CreateWallet(addressType)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
 	wallets.SaveToFile()
 
 	fmt.Printf("Your new Address: %s\n", address)
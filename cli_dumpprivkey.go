@@ -0,0 +1,23 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+func (cli *CLI) dumpPrivKey(address string) {
+	wallets, err := NewWallets()
+	if err != nil {
+		fmt.Println("There are not any wallet,Please create one first.")
+		os.Exit(1)
+	}
+	unlockWallets(wallets)
+
+	privKey, err := wallets.DumpPrivateKey(address)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	fmt.Println(privKey)
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+var stdinReader = bufio.NewReader(os.Stdin)
+
+func (cli *CLI) encryptWallet() {
+	wallets, err := NewWallets()
+	if err != nil {
+		fmt.Println("There are not any wallet,Please create one first.")
+		os.Exit(1)
+	}
+	if wallets.IsEncrypted() {
+		fmt.Println("wallet is already encrypted, use changepassphrase to change the passphrase")
+		os.Exit(1)
+	}
+
+	err = wallets.Encrypt(readNewPassphrase())
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	wallets.SaveToFile()
+
+	fmt.Println("Wallet encrypted. Unlock it with walletpassphrase, or enter the passphrase when a command needs the private keys.")
+}
+
+// unlockWallets 解锁加密的钱包：walletpassphrase 解锁期间从解锁代理取得主密钥，否则询问口令。
+// 主密钥只保存在这个进程的内存中
+func unlockWallets(wallets *Wallets) {
+	if !wallets.IsEncrypted() {
+		return
+	}
+	if masterKey := fetchAgentKey(); masterKey != nil && wallets.unlockWithKey(masterKey) == nil {
+		return
+	}
+
+	err := wallets.Unlock(readPassphrase("Wallet passphrase: "))
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+}
+
+// readPassphrase 从终端读取口令，输入时不回显。
+// 标准输入不是终端时读取一行，脚本可以通过管道传入口令，口令不会出现在命令行参数中
+func readPassphrase(prompt string) string {
+	fd := int(os.Stdin.Fd())
+	if term.IsTerminal(fd) {
+		fmt.Fprint(os.Stderr, prompt)
+		passphrase, err := term.ReadPassword(fd)
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			fmt.Println("Cannot read the passphrase:", err)
+			os.Exit(1)
+		}
+		return string(passphrase)
+	}
+
+	line, err := stdinReader.ReadString('\n')
+	if err != nil && (err != io.EOF || line == "") {
+		fmt.Println("Cannot read the passphrase:", err)
+		os.Exit(1)
+	}
+
+	return strings.TrimRight(line, "\r\n")
+}
+
+// readNewPassphrase 读取两次新口令，两次输入必须相同
+func readNewPassphrase() string {
+	passphrase := readPassphrase("New passphrase: ")
+	if passphrase == "" {
+		fmt.Println("The passphrase must not be empty")
+		os.Exit(1)
+	}
+	if readPassphrase("Repeat the new passphrase: ") != passphrase {
+		fmt.Println("The passphrases do not match")
+		os.Exit(1)
+	}
+
+	return passphrase
+}
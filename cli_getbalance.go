@@ -6,21 +6,14 @@ import (
 )
 
 func (cli *CLI) getBalance(address string) {
-	if !ValidateAddress(address) {
-		log.Panic("ERROR: Address is not valid")
+	pubKeyHash, err := DecodeAddress(address)
+	if err != nil {
+		log.Panic("ERROR: Address is not valid: ", err)
 	}
 	bc := NewBlockchain()
-	UTXOSet := UTXOSet{bc}
 	defer bc.db.Close()
 
-	balance := 0
-	pubKeyHash := Base58Decode([]byte(address))
-	pubKeyHash = pubKeyHash[1 : len(pubKeyHash)-4]
-	UTXOs := UTXOSet.FindUTXO(pubKeyHash)
-
-	for _, out := range UTXOs {
-		balance += out.Value
-	}
+	balance := bc.GetAddressBalance(pubKeyHash)
 
 	fmt.Printf("Balance of '%s': %d\n", address, balance)
 }
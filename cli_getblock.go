@@ -0,0 +1,17 @@
+package main
+
+import (
+	"log"
+)
+
+func (cli *CLI) getBlock(height int) {
+	bc := NewBlockchain()
+	defer bc.db.Close()
+
+	block, err := bc.GetBlockByHeight(height)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	printBlock(&block)
+}
@@ -0,0 +1,17 @@
+package main
+
+import (
+	"fmt"
+)
+
+func (cli *CLI) getSupply() {
+	bc := NewBlockchain()
+	defer bc.db.Close()
+
+	height := bc.GetBestHeight()
+
+	fmt.Printf("Height: %d\n", height)
+	fmt.Printf("Issued: %d\n", IssuedSupply(height))
+	fmt.Printf("Max supply: %d\n", activeNetParams.MaxSupply)
+	fmt.Printf("Next block subsidy: %d\n", GetBlockSubsidy(height+1))
+}
@@ -0,0 +1,22 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+func (cli *CLI) importAddress(address string, rescan bool) {
+	wallets, _ := NewWallets()
+
+	err := wallets.ImportAddress(address)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	wallets.SaveToFile()
+
+	fmt.Printf("Watching Address: %s\n", address)
+	if rescan {
+		rescanAddress(address)
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+func (cli *CLI) importPrivKey(privKey, addressType string, rescan bool) {
+	wallet, err := DecodePrivateKey(privKey)
+	if err != nil {
+		fmt.Println("Invalid private key:", err)
+		os.Exit(1)
+	}
+
+	wallets, _ := NewWallets()
+	unlockWallets(wallets)
+	address, err := wallets.ImportWallet(wallet, addressType)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	wallets.SaveToFile()
+
+	fmt.Printf("Imported Address: %s\n", address)
+	if rescan {
+		rescanAddress(address)
+	}
+}
+
+// rescanAddress 打印导入地址的交易记录和余额。
+// 地址索引包含链上所有地址，导入的地址不需要重新扫描区块，交易记录和余额立即可以查询
+func rescanAddress(address string) {
+	if !dbExists(dbPath()) {
+		fmt.Println("No existing blockchain found, skipping rescan.")
+		return
+	}
+
+	bc := NewBlockchain()
+	defer bc.db.Close()
+
+	pubKeyHash, err := DecodeAddress(address)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	printAddressHistory(bc, address, pubKeyHash)
+	fmt.Printf("Balance at height %d: %d\n", bc.GetBestHeight(), bc.GetAddressBalance(pubKeyHash))
+}
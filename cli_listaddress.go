@@ -16,4 +16,7 @@ func (cli *CLI) listAddresses() {
 	for _, address := range addresses {
 		fmt.Println(address)
 	}
+	for _, address := range wallets.GetWatchOnlyAddresses() {
+		fmt.Println(address, "(watch-only)")
+	}
 }
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+)
+
+func (cli *CLI) listTransactions(address string) {
+	pubKeyHash, err := DecodeAddress(address)
+	if err != nil {
+		log.Panic("ERROR: Address is not valid: ", err)
+	}
+	bc := NewBlockchain()
+	defer bc.db.Close()
+
+	printAddressHistory(bc, address, pubKeyHash)
+}
+
+// printAddressHistory 打印地址的交易记录，来自地址索引
+func printAddressHistory(bc *Blockchain, address string, pubKeyHash []byte) {
+	events := bc.GetAddressHistory(pubKeyHash)
+	bestHeight := bc.GetBestHeight()
+
+	fmt.Printf("Transactions of '%s':\n", address)
+	//同一笔交易的收款和付款合并为一行，金额为该地址的净收入
+	for i := 0; i < len(events); {
+		e := events[i]
+		amount := 0
+		for ; i < len(events) && bytes.Equal(events[i].Txid, e.Txid); i++ {
+			if events[i].Spending {
+				amount -= events[i].Value
+			} else {
+				amount += events[i].Value
+			}
+		}
+
+		fmt.Printf("%x  Height: %d  Amount: %+d  Confirmations: %d\n", e.Txid, e.Height, amount, bestHeight-e.Height+1)
+	}
+}
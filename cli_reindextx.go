@@ -0,0 +1,11 @@
+package main
+
+import "fmt"
+
+func (cli *CLI) reindexTx() {
+	bc := NewBlockchain()
+	defer bc.db.Close()
+
+	count := bc.ReindexTransactions()
+	fmt.Printf("Done! There are %d transactions in the transaction index.\n", count)
+}
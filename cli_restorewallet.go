@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// restoreWallet 用助记词恢复HD钱包，有区块链时按 gap limit 找出所有用过的地址
+func (cli *CLI) restoreWallet(mnemonic, addressType string, gapLimit int) {
+	if _, err := os.Stat(walletPath()); err == nil {
+		fmt.Printf("Wallet file %s already exists, move it away before restoring.\n", walletPath())
+		os.Exit(1)
+	}
+
+	seed, err := mnemonicToSeed(mnemonic)
+	if err != nil {
+		fmt.Println("Invalid recovery phrase:", err)
+		os.Exit(1)
+	}
+
+	wallets, _ := NewWallets()
+	err = wallets.SetHDSeed(seed)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	used := func(pubKeyHash []byte) bool { return false }
+	if dbExists(dbPath()) {
+		bc := NewBlockchain()
+		defer bc.db.Close()
+		used = func(pubKeyHash []byte) bool { return len(bc.GetAddressHistory(pubKeyHash)) > 0 }
+	}
+
+	found, err := wallets.DiscoverHDWallets(addressType, gapLimit, used)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	wallets.SaveToFile()
+
+	fmt.Printf("Restored %d addresses, %d of them have transactions\n", len(wallets.WalletMap), found)
+}
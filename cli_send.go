@@ -1,11 +1,14 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
+	"os"
 )
 
-func (cli *CLI) send(from, to string, amount int, mineNow bool) {
+// send 转账，coinControl 为nil时用默认策略选择输入
+func (cli *CLI) send(from, to string, amount, fee int, mineNow bool, coinControl *CoinControl) {
 	if !ValidateAddress(from) {
 		log.Panic("ERROR: Sender Address is not valid")
 	}
@@ -21,19 +24,56 @@ func (cli *CLI) send(from, to string, amount int, mineNow bool) {
 	if err != nil {
 		log.Panic(err)
 	}
+	if !wallets.HasWallet(from) {
+		fmt.Printf("The private key of %s is not in the wallet\n", from)
+		os.Exit(1)
+	}
+	unlockWallets(wallets)
 	wallet := wallets.GetWallet(from)
 
-	tx := NewUTXOTransaction(&wallet, to, amount, &UTXOSet)
+	rtx, err := NewRawTransactionToMany(from, []Payment{{to, amount}}, fee, coinControl, &UTXOSet)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	rtx.Sign(&wallet)
+	tx := &rtx.Tx
 
 	if mineNow {
-		cbTx := NewCoinbaseTX(from, "")
+		cbTx := NewCoinbaseTX(from, "", GetBlockSubsidy(bc.GetBestHeight()+1)+fee)
 		txs := []*Transaction{cbTx, tx}
 
-		newBlock := bc.MineBlock(txs)
-		UTXOSet.Update(newBlock)
+		_, err := bc.MineBlock(context.Background(), txs)
+		if err != nil {
+			log.Panic(err)
+		}
 	} else {
-		//sendTx(knownNodes[0], tx)
+		broadcastTx(bc, tx)
 	}
 
 	fmt.Println("Success!")
 }
+
+// newCoinControl 由 send 的 -coinselect、-include 和 -exclude 选项生成 CoinControl
+func newCoinControl(strategy, include, exclude string) (*CoinControl, error) {
+	selector, err := selectCoinSelector(strategy)
+	if err != nil {
+		return nil, err
+	}
+	coinControl := &CoinControl{Selector: selector}
+
+	if include != "" {
+		coinControl.Include, err = parseOutpoints(include)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if exclude != "" {
+		coinControl.Exclude, err = parseOutpoints(exclude)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return coinControl, nil
+}
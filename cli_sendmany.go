@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// sendMany 用一笔交易向多个地址付款，付款列表来自 -to 或者 JSON 文件
+func (cli *CLI) sendMany(from, to, file string, fee int, mineNow bool) {
+	if !ValidateAddress(from) {
+		log.Panic("ERROR: Sender Address is not valid")
+	}
+
+	var payments []Payment
+	var err error
+	if file != "" {
+		payments, err = readPaymentsFile(file)
+	} else {
+		payments, err = parsePayments(to)
+	}
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	bc := NewBlockchain()
+	UTXOSet := UTXOSet{bc}
+	defer bc.db.Close()
+
+	wallets, err := NewWallets()
+	if err != nil {
+		log.Panic(err)
+	}
+	if !wallets.HasWallet(from) {
+		fmt.Printf("The private key of %s is not in the wallet\n", from)
+		os.Exit(1)
+	}
+	unlockWallets(wallets)
+	wallet := wallets.GetWallet(from)
+
+	rtx, err := NewRawTransactionToMany(from, payments, fee, nil, &UTXOSet)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	rtx.Sign(&wallet)
+	tx := &rtx.Tx
+
+	if mineNow {
+		cbTx := NewCoinbaseTX(from, "", GetBlockSubsidy(bc.GetBestHeight()+1)+fee)
+
+		_, err := bc.MineBlock(context.Background(), []*Transaction{cbTx, tx})
+		if err != nil {
+			log.Panic(err)
+		}
+	} else {
+		broadcastTx(bc, tx)
+	}
+
+	fmt.Printf("Sent %d payments in transaction %x\n", len(payments), tx.ID)
+}
+
+// parsePayments 解析 ADDRESS:AMOUNT,ADDRESS:AMOUNT 形式的付款列表
+func parsePayments(list string) ([]Payment, error) {
+	var payments []Payment
+
+	for _, item := range strings.Split(list, ",") {
+		parts := strings.Split(strings.TrimSpace(item), ":")
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("payment %q must be ADDRESS:AMOUNT", item)
+		}
+
+		amount, err := strconv.Atoi(parts[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid amount in payment %q", item)
+		}
+		payments = append(payments, Payment{parts[0], amount})
+	}
+
+	return payments, nil
+}
+
+// readPaymentsFile 读取JSON文件中的付款列表，格式为 [{"address": "...", "amount": 10}, ...]
+func readPaymentsFile(path string) ([]Payment, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var payments []Payment
+	err = json.Unmarshal(content, &payments)
+	if err != nil {
+		return nil, fmt.Errorf("invalid payments file %s: %v", path, err)
+	}
+	if len(payments) == 0 {
+		return nil, errors.New("payments file has no payments")
+	}
+
+	return payments, nil
+}
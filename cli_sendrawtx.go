@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+)
+
+// sendRawTx 检查签名完整的交易，-mine 时在当前节点直接打包，否则发送给挖矿的节点
+func (cli *CLI) sendRawTx(in string, mineNow bool, minerAddress string) {
+	rtx := readRawTx(in)
+
+	bc := NewBlockchain()
+	UTXOSet := UTXOSet{bc}
+	defer bc.db.Close()
+
+	err := rtx.CheckSpent(&UTXOSet)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	if !rtx.IsComplete() {
+		fmt.Printf("The transaction is not completely signed: %d of %d inputs\n", rtx.SignedInputs(), len(rtx.Tx.Vin))
+		os.Exit(1)
+	}
+	if rtx.Fee() < 0 {
+		fmt.Println("The transaction spends more than its inputs")
+		os.Exit(1)
+	}
+	tx := &rtx.Tx
+
+	if mineNow {
+		cbTx := NewCoinbaseTX(minerAddress, "", GetBlockSubsidy(bc.GetBestHeight()+1)+rtx.Fee())
+
+		_, err := bc.MineBlock(context.Background(), []*Transaction{cbTx, tx})
+		if err != nil {
+			log.Panic(err)
+		}
+	} else {
+		broadcastTx(bc, tx)
+	}
+
+	fmt.Printf("Transaction %x\n", tx.ID)
+}
+
+// broadcastTx 把交易发送给所有挖矿的节点
+func broadcastTx(bc *Blockchain, tx *Transaction) {
+	initNode(false, bc)
+	peers, _ := LoadPeersFromFile()
+	for _, peer := range peers.PeerList {
+		if !peer.Mining {
+			continue
+		}
+		fmt.Printf("正在发送交易至节点%s", peer.Address)
+		if sendTx(peer.Address, tx) != nil {
+			fmt.Println("\t失败")
+			continue
+		}
+		fmt.Println("\t成功")
+	}
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// signRawTx 用钱包中的私钥签名未签名交易，只需要钱包文件，可以在不联网的机器上运行
+func (cli *CLI) signRawTx(in, out string) {
+	rtx := readRawTx(in)
+
+	wallets, err := NewWallets()
+	if err != nil {
+		fmt.Println("There are not any wallet,Please create one first.")
+		os.Exit(1)
+	}
+	unlockWallets(wallets)
+
+	signed := 0
+	for _, wallet := range wallets.WalletMap {
+		signed += rtx.Sign(wallet)
+	}
+	if signed == 0 {
+		fmt.Println("None of the inputs can be signed with the keys in this wallet")
+		os.Exit(1)
+	}
+
+	printRawTx(rtx)
+	if rtx.IsComplete() {
+		fmt.Println("The transaction is complete and can be sent with sendrawtx")
+	}
+	writeRawTx(out, rtx)
+}
@@ -2,10 +2,26 @@ package main
 
 import (
 	"fmt"
+	"log"
 )
 
-func (cli *CLI) startNode(mine bool) {
+func (cli *CLI) startNode(mine bool, minerAddress string, txIndex bool) {
+	if minerAddress != "" && !ValidateAddress(minerAddress) {
+		log.Panic("ERROR: Miner Address is not valid")
+	}
+
+	if txIndex {
+		bc := NewBlockchain()
+		if !bc.TxIndexEnabled() {
+			fmt.Println("Building transaction index")
+			count := bc.ReindexTransactions()
+			fmt.Printf("Indexed %d transactions\n", count)
+		}
+		bc.db.Close()
+	}
+
 	fmt.Printf("Starting node\n")
 	Mining = mine
+	miningAddress = minerAddress
 	StartServer()
 }
@@ -0,0 +1,13 @@
+package main
+
+import "fmt"
+
+// walletLock 结束 walletpassphrase 的解锁
+func (cli *CLI) walletLock() {
+	if !lockWalletAgent() {
+		fmt.Println("Wallet is not unlocked")
+		return
+	}
+
+	fmt.Println("Wallet locked")
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// walletPassphrase 解锁钱包timeout秒，主密钥交给后台的解锁代理保存，见 wallet_agent.go
+func (cli *CLI) walletPassphrase(timeout int) {
+	wallets, err := NewWallets()
+	if err != nil {
+		fmt.Println("There are not any wallet,Please create one first.")
+		os.Exit(1)
+	}
+	if !wallets.IsEncrypted() {
+		fmt.Println("wallet is not encrypted, use encryptwallet first")
+		os.Exit(1)
+	}
+
+	err = wallets.Unlock(readPassphrase("Wallet passphrase: "))
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	//重新解锁时替换原来的代理，从现在开始计时
+	lockWalletAgent()
+	err = startWalletAgent(wallets.masterKey, timeout)
+	if err != nil {
+		fmt.Println("Cannot keep the wallet unlocked:", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Wallet unlocked for %d seconds\n", timeout)
+}
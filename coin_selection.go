@@ -0,0 +1,309 @@
+package main
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+/**
+选币策略
+付款时要从地址的未花费输出中选出一些作为交易的输入，金额之和不小于付款金额加交易费，多出的部分找零。
+不同的选法各有好处：
+  first   按UTXO集中的顺序选，直到金额足够，是原来的做法
+  largest 先选金额大的输出，输入最少
+  bnb     分支定界搜索金额之和正好等于目标的组合，不需要找零，找不到时按 largest 选
+  random  随机选到金额足够，再随机加入输出使总额接近目标的2倍，找零和付款金额相近，同时逐渐合并零钱
+调用者还可以指定一定要花费的输出（Include）和不能花费的输出（Exclude）
+*/
+
+// ErrInsufficientFunds 表示可以花费的输出金额不够
+var ErrInsufficientFunds = errors.New("Not enough funds")
+
+// bnbMaxTries 分支定界最多搜索的节点数，超过后放弃精确匹配
+const bnbMaxTries = 100000
+
+// Outpoint 指向一笔交易的一个输出
+type Outpoint struct {
+	Txid []byte
+	Vout int
+}
+
+// String 返回 txid:vout 形式的输出位置
+func (o Outpoint) String() string {
+	return fmt.Sprintf("%x:%d", o.Txid, o.Vout)
+}
+
+// parseOutpoints 解析逗号分隔的 txid:vout 列表
+func parseOutpoints(list string) ([]Outpoint, error) {
+	var outpoints []Outpoint
+
+	for _, item := range strings.Split(list, ",") {
+		parts := strings.Split(strings.TrimSpace(item), ":")
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("outpoint %q must be TXID:VOUT", item)
+		}
+
+		txid, err := hex.DecodeString(parts[0])
+		if err != nil || len(txid) == 0 {
+			return nil, fmt.Errorf("invalid transaction ID in outpoint %q", item)
+		}
+		vout, err := strconv.Atoi(parts[1])
+		if err != nil || vout < 0 {
+			return nil, fmt.Errorf("invalid output index in outpoint %q", item)
+		}
+		outpoints = append(outpoints, Outpoint{txid, vout})
+	}
+
+	return outpoints, nil
+}
+
+// Coin 是一个可以花费的输出和它的位置
+type Coin struct {
+	Outpoint
+	Output TXOutput
+}
+
+// CoinSelector 从 coins 中选出金额之和不小于 target 的输出
+type CoinSelector interface {
+	Name() string
+	Select(coins []Coin, target int) ([]Coin, error)
+}
+
+// coinSelectors 是 -coinselect 可以选择的策略，第一个是默认策略
+var coinSelectors = []CoinSelector{
+	firstFitSelector{},
+	largestFirstSelector{},
+	branchAndBoundSelector{},
+	randomImproveSelector{},
+}
+
+// selectCoinSelector returns the coin selection strategy by name
+func selectCoinSelector(name string) (CoinSelector, error) {
+	var names []string
+
+	for _, selector := range coinSelectors {
+		if selector.Name() == name {
+			return selector, nil
+		}
+		names = append(names, selector.Name())
+	}
+
+	return nil, fmt.Errorf("unknown coin selection %q, expected one of %s", name, strings.Join(names, ", "))
+}
+
+// CoinControl 控制交易花费哪些输出，nil 时使用默认策略
+type CoinControl struct {
+	Selector CoinSelector
+	Include  []Outpoint //一定要花费的输出
+	Exclude  []Outpoint //不能花费的输出
+}
+
+// selectCoins 先加入指定的输出，不够的部分由选币策略从其余的输出中选出
+func (cc *CoinControl) selectCoins(coins []Coin, target int) ([]Coin, error) {
+	if cc == nil {
+		return coinSelectors[0].Select(coins, target)
+	}
+
+	byOutpoint := make(map[string]Coin)
+	for _, coin := range coins {
+		byOutpoint[coin.String()] = coin
+	}
+	for _, outpoint := range cc.Exclude {
+		delete(byOutpoint, outpoint.String())
+	}
+
+	var selected []Coin
+	for _, outpoint := range cc.Include {
+		coin, ok := byOutpoint[outpoint.String()]
+		if !ok {
+			return nil, fmt.Errorf("output %s is not a spendable output of the sender", outpoint)
+		}
+		delete(byOutpoint, outpoint.String())
+		selected = append(selected, coin)
+		target -= coin.Output.Value
+	}
+	if target <= 0 {
+		return selected, nil
+	}
+
+	//保持UTXO集中的顺序，first 策略依赖它
+	var rest []Coin
+	for _, coin := range coins {
+		if _, ok := byOutpoint[coin.String()]; ok {
+			rest = append(rest, coin)
+		}
+	}
+
+	selector := cc.Selector
+	if selector == nil {
+		selector = coinSelectors[0]
+	}
+	more, err := selector.Select(rest, target)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(selected, more...), nil
+}
+
+func sumCoins(coins []Coin) int {
+	sum := 0
+
+	for _, coin := range coins {
+		sum += coin.Output.Value
+	}
+
+	return sum
+}
+
+// firstFitSelector 按顺序选择输出，直到金额足够
+type firstFitSelector struct{}
+
+func (firstFitSelector) Name() string {
+	return "first"
+}
+
+func (firstFitSelector) Select(coins []Coin, target int) ([]Coin, error) {
+	var selected []Coin
+	accumulated := 0
+
+	for _, coin := range coins {
+		if accumulated >= target {
+			break
+		}
+		accumulated += coin.Output.Value
+		selected = append(selected, coin)
+	}
+	if accumulated < target {
+		return nil, ErrInsufficientFunds
+	}
+
+	return selected, nil
+}
+
+// largestFirstSelector 先选择金额大的输出
+type largestFirstSelector struct{}
+
+func (largestFirstSelector) Name() string {
+	return "largest"
+}
+
+func (largestFirstSelector) Select(coins []Coin, target int) ([]Coin, error) {
+	return firstFitSelector{}.Select(sortCoinsDescending(coins), target)
+}
+
+func sortCoinsDescending(coins []Coin) []Coin {
+	sorted := append([]Coin(nil), coins...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Output.Value > sorted[j].Output.Value
+	})
+
+	return sorted
+}
+
+// branchAndBoundSelector 搜索金额之和正好等于 target 的组合，这样交易没有找零输出。
+// 按金额从大到小依次决定每个输出选或不选，已选的金额超过 target 或者剩下的输出全选也不够时剪枝
+type branchAndBoundSelector struct{}
+
+func (branchAndBoundSelector) Name() string {
+	return "bnb"
+}
+
+func (branchAndBoundSelector) Select(coins []Coin, target int) ([]Coin, error) {
+	sorted := sortCoinsDescending(coins)
+
+	//remaining[i] 是第i个及之后的输出的金额之和
+	remaining := make([]int, len(sorted)+1)
+	for i := len(sorted) - 1; i >= 0; i-- {
+		remaining[i] = remaining[i+1] + sorted[i].Output.Value
+	}
+	if remaining[0] < target {
+		return nil, ErrInsufficientFunds
+	}
+
+	chosen := make([]bool, len(sorted))
+	tries := 0
+	var search func(i, sum int) bool
+	search = func(i, sum int) bool {
+		tries++
+		if sum == target {
+			return true
+		}
+		if i == len(sorted) || sum > target || sum+remaining[i] < target || tries > bnbMaxTries {
+			return false
+		}
+
+		chosen[i] = true
+		if search(i+1, sum+sorted[i].Output.Value) {
+			return true
+		}
+		chosen[i] = false
+
+		return search(i+1, sum)
+	}
+
+	if !search(0, 0) {
+		return largestFirstSelector{}.Select(coins, target)
+	}
+
+	var selected []Coin
+	for i, coin := range sorted {
+		if chosen[i] {
+			selected = append(selected, coin)
+		}
+	}
+
+	return selected, nil
+}
+
+// randomImproveSelector 先随机选择输出直到金额足够，再依次尝试加入随机的输出，
+// 只要总额更接近 2*target 并且不超过 3*target 就加入，否则停止
+type randomImproveSelector struct {
+	rand *rand.Rand //为nil时使用全局的随机数
+}
+
+func (randomImproveSelector) Name() string {
+	return "random"
+}
+
+func (s randomImproveSelector) Select(coins []Coin, target int) ([]Coin, error) {
+	shuffled := append([]Coin(nil), coins...)
+	shuffle := rand.Shuffle
+	if s.rand != nil {
+		shuffle = s.rand.Shuffle
+	}
+	shuffle(len(shuffled), func(i, j int) {
+		shuffled[i], shuffled[j] = shuffled[j], shuffled[i]
+	})
+
+	selected, err := firstFitSelector{}.Select(shuffled, target)
+	if err != nil {
+		return nil, err
+	}
+
+	sum := sumCoins(selected)
+	ideal, limit := 2*target, 3*target
+	for _, coin := range shuffled[len(selected):] {
+		next := sum + coin.Output.Value
+		if next > limit || abs(ideal-next) >= abs(ideal-sum) {
+			break
+		}
+		selected = append(selected, coin)
+		sum = next
+	}
+
+	return selected, nil
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+
+	return x
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testCoins(values ...int) []Coin {
+	var coins []Coin
+
+	for i, value := range values {
+		coins = append(coins, Coin{Outpoint{[]byte{byte(i + 1)}, 0}, TXOutput{Value: value}})
+	}
+
+	return coins
+}
+
+func coinValues(coins []Coin) []int {
+	var values []int
+
+	for _, coin := range coins {
+		values = append(values, coin.Output.Value)
+	}
+
+	return values
+}
+
+func TestCoinSelectors(t *testing.T) {
+	coins := testCoins(3, 8, 1, 5, 2)
+
+	selected, err := firstFitSelector{}.Select(coins, 10)
+	assert.Nil(t, err)
+	assert.Equal(t, []int{3, 8}, coinValues(selected))
+
+	selected, err = largestFirstSelector{}.Select(coins, 10)
+	assert.Nil(t, err)
+	assert.Equal(t, []int{8, 5}, coinValues(selected))
+
+	//8+2 正好等于10，不需要找零
+	selected, err = branchAndBoundSelector{}.Select(coins, 10)
+	assert.Nil(t, err)
+	assert.Equal(t, 10, sumCoins(selected))
+
+	//没有精确匹配时和 largest 一样
+	selected, err = branchAndBoundSelector{}.Select(testCoins(4, 6, 9), 12)
+	assert.Nil(t, err)
+	assert.Equal(t, []int{9, 6}, coinValues(selected))
+
+	//改进阶段继续加入输出，直到总额最接近2倍的目标
+	random := randomImproveSelector{rand.New(rand.NewSource(1))}
+	for i := 0; i < 20; i++ {
+		selected, err = random.Select(testCoins(1, 1, 1, 1, 1, 1, 1, 1, 1, 1), 2)
+		assert.Nil(t, err)
+		assert.Equal(t, 4, sumCoins(selected))
+	}
+
+	for _, selector := range coinSelectors {
+		_, err = selector.Select(coins, 20)
+		assert.Equal(t, ErrInsufficientFunds, err, selector.Name())
+	}
+}
+
+func TestCoinControl(t *testing.T) {
+	coins := testCoins(3, 8, 1, 5, 2)
+
+	selector, err := selectCoinSelector("largest")
+	assert.Nil(t, err)
+	_, err = selectCoinSelector("smallest")
+	assert.NotNil(t, err)
+
+	//指定的输出一定被花费，不能花费的输出不会被选中
+	cc := &CoinControl{Selector: selector, Include: []Outpoint{coins[2].Outpoint}, Exclude: []Outpoint{coins[1].Outpoint}}
+	selected, err := cc.selectCoins(coins, 7)
+	assert.Nil(t, err)
+	assert.Equal(t, []int{1, 5, 3}, coinValues(selected))
+
+	selected, err = (&CoinControl{Include: []Outpoint{coins[1].Outpoint}}).selectCoins(coins, 7)
+	assert.Nil(t, err)
+	assert.Equal(t, []int{8}, coinValues(selected))
+
+	_, err = (&CoinControl{Include: []Outpoint{{[]byte{9}, 0}}}).selectCoins(coins, 7)
+	assert.NotNil(t, err)
+	_, err = (&CoinControl{Exclude: []Outpoint{coins[1].Outpoint}}).selectCoins(coins, 12)
+	assert.Equal(t, ErrInsufficientFunds, err)
+
+	outpoints, err := parseOutpoints("01:0, 02:3")
+	assert.Nil(t, err)
+	assert.Equal(t, []Outpoint{coins[0].Outpoint, {[]byte{2}, 3}}, outpoints)
+	_, err = parseOutpoints("01")
+	assert.NotNil(t, err)
+	_, err = parseOutpoints("zz:0")
+	assert.NotNil(t, err)
+}
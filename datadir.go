@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+/**
+数据目录
+每个网络的区块链数据库、钱包和peer列表都保存在数据目录下该网络的子目录中，主网的子目录名为空，
+即直接保存在数据目录中，这样默认的数据目录（当前目录）和旧版本的文件位置相同。
+同一个网络的目录同时只能被一个进程使用，用目录中的锁文件保证
+*/
+
+const lockFile = ".lock"
+
+var dataDir = "." //数据目录，由 -datadir 选项指定
+
+// networkDir returns the directory holding the files of the current network
+func networkDir() string {
+	return filepath.Join(dataDir, activeNetParams.DataSubdir)
+}
+
+func dbPath() string {
+	return filepath.Join(networkDir(), dbFile)
+}
+
+func walletPath() string {
+	return filepath.Join(networkDir(), walletFile)
+}
+
+func peerPath() string {
+	return filepath.Join(networkDir(), PeerFile)
+}
+
+// lockNetworkDir creates the directory of the current network and locks it for this process.
+// The lock is released when the returned file is closed or the process exits
+func lockNetworkDir() (*os.File, error) {
+	dir := networkDir()
+
+	err := os.MkdirAll(dir, 0700)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.OpenFile(filepath.Join(dir, lockFile), os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	err = lockFileExclusive(f)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("data directory %s is in use by another process: %v", dir, err)
+	}
+
+	return f, nil
+}
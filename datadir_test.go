@@ -0,0 +1,36 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLockNetworkDir(t *testing.T) {
+	defer func(old string) { dataDir = old }(dataDir)
+	defer func(old *ChainParams) { activeNetParams = old }(activeNetParams)
+	dataDir = t.TempDir()
+	activeNetParams = &RegTestParams
+
+	lock, err := lockNetworkDir()
+	assert.Nil(t, err)
+	_, err = os.Stat(filepath.Join(dataDir, RegTestParams.DataSubdir, lockFile))
+	assert.Nil(t, err)
+
+	//同一个目录不能再次加锁，其他网络的目录不受影响
+	_, err = lockNetworkDir()
+	assert.NotNil(t, err)
+	activeNetParams = &TestNetParams
+	other, err := lockNetworkDir()
+	assert.Nil(t, err)
+	other.Close()
+
+	//释放后可以重新加锁
+	activeNetParams = &RegTestParams
+	lock.Close()
+	lock, err = lockNetworkDir()
+	assert.Nil(t, err)
+	lock.Close()
+}
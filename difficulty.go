@@ -0,0 +1,102 @@
+package main
+
+import (
+	"math/big"
+)
+
+/**
+难度调整
+和比特币一样，每隔 RetargetInterval 个区块根据这段时间实际花费的时间重新计算一次目标值：
+实际时间比预期短，说明算力上升，目标值变小（难度变大）；反之目标值变大（难度变小）。
+每次调整的幅度限制在 MaxRetargetFactor 倍以内，目标值不能超过 PowLimit。
+这些参数都在当前网络的 ChainParams 中
+目标值以比特币的 compact 格式（Bits）保存在区块中，高 8 位是字节数，低 24 位是尾数
+*/
+
+// CompactToBig converts the compact representation of a target to a big integer
+func CompactToBig(compact uint32) *big.Int {
+	mantissa := compact & 0x007fffff
+	isNegative := compact&0x00800000 != 0
+	exponent := uint(compact >> 24)
+
+	var bn *big.Int
+	if exponent <= 3 {
+		mantissa >>= 8 * (3 - exponent)
+		bn = big.NewInt(int64(mantissa))
+	} else {
+		bn = big.NewInt(int64(mantissa))
+		bn.Lsh(bn, 8*(exponent-3))
+	}
+
+	if isNegative {
+		bn = bn.Neg(bn)
+	}
+
+	return bn
+}
+
+// BigToCompact converts a target to its compact representation
+func BigToCompact(n *big.Int) uint32 {
+	if n.Sign() == 0 {
+		return 0
+	}
+
+	var mantissa uint32
+	exponent := uint(len(n.Bytes()))
+	if exponent <= 3 {
+		mantissa = uint32(n.Bits()[0])
+		mantissa <<= 8 * (3 - exponent)
+	} else {
+		tn := new(big.Int).Abs(n)
+		mantissa = uint32(tn.Rsh(tn, 8*(exponent-3)).Bits()[0])
+	}
+
+	//尾数的最高位是符号位，被占用时把尾数右移一个字节
+	if mantissa&0x00800000 != 0 {
+		mantissa >>= 8
+		exponent++
+	}
+
+	compact := uint32(exponent<<24) | mantissa
+	if n.Sign() < 0 {
+		compact |= 0x00800000
+	}
+
+	return compact
+}
+
+// calcNextBits 计算在parent之后的区块应该使用的难度
+func calcNextBits(tx StorageTx, parent *BlockIndex) uint32 {
+	params := activeNetParams
+	if params.NoRetargeting {
+		return params.PowLimitBits
+	}
+	if (parent.Height+1)%params.RetargetInterval != 0 {
+		return parent.Bits
+	}
+
+	//找到本调整周期的第一个区块
+	first := parent
+	for i := 0; i < params.RetargetInterval-1 && len(first.PrevBlockHash) > 0; i++ {
+		first = getBlockIndex(tx, first.PrevBlockHash)
+	}
+
+	targetTimespan := params.TargetTimespan()
+	actualTimespan := parent.Timestamp - first.Timestamp
+	if actualTimespan < targetTimespan/params.MaxRetargetFactor {
+		actualTimespan = targetTimespan / params.MaxRetargetFactor
+	}
+	if actualTimespan > targetTimespan*params.MaxRetargetFactor {
+		actualTimespan = targetTimespan * params.MaxRetargetFactor
+	}
+
+	newTarget := CompactToBig(parent.Bits)
+	newTarget.Mul(newTarget, big.NewInt(actualTimespan))
+	newTarget.Div(newTarget, big.NewInt(targetTimespan))
+
+	if newTarget.Cmp(params.PowLimit) > 0 {
+		newTarget.Set(params.PowLimit)
+	}
+
+	return BigToCompact(newTarget)
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompactToBig(t *testing.T) {
+	target := CompactToBig(0x1d00ffff)
+
+	assert.Equal(
+		t,
+		"00000000ffff0000000000000000000000000000000000000000000000000000",
+		fmt.Sprintf("%064x", target),
+		"Bitcoin genesis target is decoded",
+	)
+	assert.Equal(t, uint32(0x1d00ffff), BigToCompact(target), "Bitcoin genesis bits are encoded")
+}
+
+func TestBigToCompact(t *testing.T) {
+	assert.Equal(t, uint32(0x1e100000), MainNetParams.PowLimitBits, "powLimit bits")
+	for _, params := range []*ChainParams{&MainNetParams, &TestNetParams, &RegTestParams} {
+		assert.Equal(t, 0, params.PowLimit.Cmp(CompactToBig(params.PowLimitBits)), params.Name+" powLimit round trip")
+	}
+
+	//尾数最高位被占用时需要多用一个字节
+	assert.Equal(t, uint32(0x02008000), BigToCompact(big.NewInt(0x80)))
+	assert.Equal(t, uint32(0x04123456), BigToCompact(big.NewInt(0x12345600)))
+}
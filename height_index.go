@@ -0,0 +1,42 @@
+package main
+
+import (
+	"log"
+)
+
+const heightIndexBucket = "heightindex"
+
+// 高度索引表记录主链上每个高度对应的区块Hash，key为大端序的高度，
+// 所以用游标可以按高度顺序遍历主链。侧链区块不在这张表中
+
+// getHashByHeight 在事务内查找主链上指定高度的区块Hash，不存在时返回nil
+func getHashByHeight(tx StorageTx, height int) []byte {
+	return tx.Bucket([]byte(heightIndexBucket)).Get(IntToHex(int64(height)))
+}
+
+// putHeight 在事务内把区块记为主链上指定高度的区块
+func putHeight(tx StorageTx, height int, hash []byte) {
+	err := tx.Bucket([]byte(heightIndexBucket)).Put(IntToHex(int64(height)), hash)
+	if err != nil {
+		log.Panic(err)
+	}
+}
+
+// deleteHeight 在事务内删除主链上指定高度的记录
+func deleteHeight(tx StorageTx, height int) {
+	err := tx.Bucket([]byte(heightIndexBucket)).Delete(IntToHex(int64(height)))
+	if err != nil {
+		log.Panic(err)
+	}
+}
+
+// indexHeights 为从创世区块到tip的主链区块建立高度索引
+func indexHeights(tx StorageTx, tip []byte) {
+	b := tx.Bucket([]byte(blocksBucket))
+
+	for hash := tip; len(hash) > 0; {
+		block := DeserializeBlock(b.Get(hash))
+		putHeight(tx, block.Height, block.Hash)
+		hash = block.PrevBlockHash
+	}
+}
@@ -20,28 +20,28 @@ type MerkleNode struct {
 func NewMerkleTree(data [][]byte) *MerkleTree {
 	var nodes []MerkleNode
 
-	if len(data)%2 != 0 {
-		data = append(data, data[len(data)-1])
-	}
-
 	for _, datum := range data {
 		node := NewMerkleNode(nil, nil, datum)
 		nodes = append(nodes, *node)
 	}
 
-	for i := 0; i < len(data)/2; i++ {
+	//每一层的节点数是奇数时，拷贝一份最后一个节点,比如一个区块有5笔交易，第二层就会有三个节点
+	for {
+		if len(nodes)%2 != 0 {
+			nodes = append(nodes, nodes[len(nodes)-1])
+		}
+
 		var newLevel []MerkleNode
 
 		for j := 0; j < len(nodes); j += 2 {
 			node := NewMerkleNode(&nodes[j], &nodes[j+1], nil)
 			newLevel = append(newLevel, *node)
 		}
-		//如果叶子节点是奇数，拷贝一份最后一个节点,比如一个区块有5笔或者6笔交易，就会有三个叶子节点
-		//if len(newLevel)%2 != 0 {
-		//	newLevel=append(newLevel, newLevel[len(newLevel)-1])
-		//}
 
 		nodes = newLevel
+		if len(nodes) == 1 {
+			break
+		}
 	}
 
 	mTree := MerkleTree{&nodes[0]}
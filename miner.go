@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Miner 多线程挖矿：把 nonce 空间分给多个 worker 并行搜索，通过 context 可以随时中止，
+// 比如收到了 peer 的新区块，当前链顶已经过时。
+// nonce 空间用完时更新区块的时间戳，时间戳不能更新时（一秒之内用完）修改 coinbase 中的 extra nonce，然后重新搜索
+type Miner struct {
+	Workers int //并行搜索的 worker 数
+
+	hashes  uint64        //上一次挖矿计算的Hash次数
+	elapsed time.Duration //上一次挖矿花费的时间
+}
+
+type miningResult struct {
+	nonce uint32
+	hash  []byte
+}
+
+// NewMiner creates a Miner with one worker per CPU
+func NewMiner() *Miner {
+	return &Miner{Workers: runtime.NumCPU()}
+}
+
+// Mine 对区块做工作量证明，成功时设置区块的 Nonce 和 Hash。
+// ctx 被取消时返回 ctx.Err()，区块保持未完成的状态
+func (m *Miner) Mine(ctx context.Context, block *Block) error {
+	var extraNonce int64
+	var coinbaseData []byte
+	start := time.Now()
+	m.hashes = 0
+	defer func() { m.elapsed = time.Since(start) }()
+
+	if len(block.Transactions) > 0 && block.Transactions[0].IsCoinbase() {
+		coinbaseData = append([]byte{}, block.Transactions[0].Vin[0].PubKey...)
+	}
+
+	fmt.Printf("Mining a new block\n")
+	for {
+		result, err := m.search(ctx, block)
+		if err != nil {
+			return err
+		}
+		if result != nil {
+			block.Nonce = result.nonce
+			block.Hash = result.hash
+			fmt.Printf("%x\n", result.hash)
+			return nil
+		}
+
+		//nonce 空间已经用完，换一个区块头重新搜索
+		if now := time.Now().Unix(); now > block.Timestamp {
+			block.Timestamp = now
+		} else if coinbaseData != nil {
+			extraNonce++
+			coinbase := block.Transactions[0]
+			coinbase.Vin[0].PubKey = append(append([]byte{}, coinbaseData...), IntToHex(extraNonce)...)
+			coinbase.ID = coinbase.unsignedHash()
+			block.MerkleRoot = block.HashTransactions()
+		} else {
+			time.Sleep(time.Second)
+		}
+	}
+}
+
+// search 用所有 worker 搜索一遍当前区块头的 nonce 空间，没有找到时返回 nil
+func (m *Miner) search(ctx context.Context, block *Block) (*miningResult, error) {
+	var stop int32
+	var wg sync.WaitGroup
+	pow := NewProofOfWork(block)
+	workers := m.Workers
+	if workers < 1 {
+		workers = 1
+	}
+	results := make(chan miningResult, workers)
+	done := make(chan struct{})
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(start uint32) {
+			defer wg.Done()
+			nonce, hash, found, hashes := pow.search(start, uint32(workers), &stop)
+			atomic.AddUint64(&m.hashes, hashes)
+			if found {
+				atomic.StoreInt32(&stop, 1)
+				results <- miningResult{nonce, hash}
+			}
+		}(uint32(i))
+	}
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-ctx.Done():
+		atomic.StoreInt32(&stop, 1)
+		<-done
+		return nil, ctx.Err()
+	case <-done:
+	}
+
+	select {
+	case result := <-results:
+		return &result, nil
+	default:
+		return nil, nil
+	}
+}
+
+// HashRate returns the hashes per second of the last Mine call
+func (m *Miner) HashRate() float64 {
+	if m.elapsed <= 0 {
+		return 0
+	}
+
+	return float64(atomic.LoadUint64(&m.hashes)) / m.elapsed.Seconds()
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMinerSolve(t *testing.T) {
+	coinbase := NewCoinbaseTX(string(NewWallet().GetAddress()), "", GetBlockSubsidy(1))
+	block := newBlockTemplate([]*Transaction{coinbase}, []byte("prev"), 1, RegTestParams.PowLimitBits)
+
+	miner := &Miner{Workers: 4}
+	assert.Nil(t, miner.Mine(context.Background(), block))
+	assert.True(t, NewProofOfWork(block).Validate())
+	assert.Equal(t, block.BlockHeader.Hash(), block.Hash)
+	assert.True(t, miner.HashRate() > 0)
+}
+
+func TestMinerRollsHeader(t *testing.T) {
+	defer func(old uint64) { maxNonce = old }(maxNonce)
+	maxNonce = 0
+
+	//每个区块头只能试 nonce 0，选一个 nonce 0 不满足目标的区块，挖矿时必须修改区块头
+	var block *Block
+	var coinbase *Transaction
+	for block == nil || NewProofOfWork(block).Validate() {
+		coinbase = NewCoinbaseTX(string(NewWallet().GetAddress()), "", GetBlockSubsidy(1))
+		block = newBlockTemplate([]*Transaction{coinbase}, []byte("prev"), 1, RegTestParams.PowLimitBits)
+	}
+	timestamp, merkleRoot := block.Timestamp, block.MerkleRoot
+	coinbaseData := coinbase.Vin[0].PubKey
+
+	assert.Nil(t, (&Miner{Workers: 1}).Mine(context.Background(), block))
+	assert.Equal(t, uint32(0), block.Nonce)
+	assert.True(t, NewProofOfWork(block).Validate())
+	assert.True(t, block.Timestamp != timestamp || !bytes.Equal(block.MerkleRoot, merkleRoot))
+
+	//extra nonce 写在 coinbase 中，交易ID和 Merkle 根随之更新
+	assert.True(t, bytes.HasPrefix(coinbase.Vin[0].PubKey, coinbaseData))
+	assert.Equal(t, coinbase.unsignedHash(), coinbase.ID)
+	assert.Equal(t, block.HashTransactions(), block.MerkleRoot)
+}
+
+func TestMinerCancel(t *testing.T) {
+	coinbase := NewCoinbaseTX(string(NewWallet().GetAddress()), "", GetBlockSubsidy(1))
+	block := newBlockTemplate([]*Transaction{coinbase}, []byte("prev"), 1, BigToCompact(big.NewInt(1)))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err := (&Miner{Workers: 4}).Mine(ctx, block)
+	assert.Equal(t, context.DeadlineExceeded, err)
+	assert.True(t, time.Since(start) < 5*time.Second)
+	assert.Empty(t, block.Hash)
+	assert.Equal(t, uint32(0), block.Nonce)
+}
@@ -41,6 +41,6 @@ func NewNode(nodeType string, mining bool, blockchain *Blockchain) *Node {
 		Type:            nodeType,
 		Mining:          mining,
 		BestBlockHeight: blockchain.GetBestHeight(),
-		Address:         fmt.Sprintf("%s:%d", GetInternalIp(), listenPort),
+		Address:         fmt.Sprintf("%s:%d", GetInternalIp(), activeNetParams.Port),
 	}
 }
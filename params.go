@@ -0,0 +1,162 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+)
+
+/**
+网络参数
+主网、测试网和回归测试网（regtest）使用不同的共识参数、地址版本、端口、种子节点和数据目录，
+节点之间的每条消息前面都带有网络标识（Magic），收到其他网络的消息直接丢弃。
+Magic 是 "pc" 加上网络的缩写，和比特币各个网络的值都不同，连到比特币节点时不会误认对方的消息。
+regtest 的难度极低且不调整，几乎每次计算Hash都能挖出区块，用于本地测试
+*/
+
+// ChainParams defines the parameters of a network
+type ChainParams struct {
+	Name       string //网络名称，用于 -network 选项
+	Magic      uint32 //网络标识，放在每条消息的开头
+	DataSubdir string //数据目录中保存该网络文件的子目录，主网为空
+	Port       int    //节点监听的端口
+	SeedPeers  []Peer //种子节点
+
+	AddressVersion byte   //Base58地址的版本号
+	Bech32HRP      string //Bech32地址的前缀
+	HDCoinType     uint32 //HD钱包派生路径 m/44'/币种'/... 中的币种
+
+	PrivateKeyVersion byte //导出私钥时Base58Check编码的版本号
+
+	GenesisCoinbaseData string //创世区块coinbase交易的数据
+
+	PowLimit           *big.Int //允许的最大目标值，也就是最低难度，创世区块使用这个难度
+	PowLimitBits       uint32   //PowLimit的compact表示
+	TargetBlockSpacing int64    //期望的出块间隔（秒）
+	RetargetInterval   int      //每隔多少个区块调整一次难度
+	MaxRetargetFactor  int64    //单次调整的最大倍数
+	NoRetargeting      bool     //不调整难度，始终使用PowLimitBits
+
+	InitialSubsidy   int //创世区块的奖励
+	HalvingInterval  int //每隔多少个区块奖励减半
+	MaxSupply        int //币的总量上限
+	CoinbaseMaturity int //coinbase的输出要再确认多少个区块才能花费
+}
+
+// TargetTimespan returns the expected duration of a retarget interval in seconds
+func (p *ChainParams) TargetTimespan() int64 {
+	return p.TargetBlockSpacing * int64(p.RetargetInterval)
+}
+
+// newPowLimit 返回要求Hash前zeroBits位为0的目标值，即1左移256-zeroBits位
+func newPowLimit(zeroBits uint) *big.Int {
+	return new(big.Int).Lsh(big.NewInt(1), 256-zeroBits)
+}
+
+var mainPowLimit = newPowLimit(20)
+var testPowLimit = newPowLimit(16)
+var regTestPowLimit = newPowLimit(1)
+
+// MainNetParams 主网参数
+var MainNetParams = ChainParams{
+	Name:       "mainnet",
+	Magic:      0x70636d6e, //"pcmn"
+	DataSubdir: "",
+	Port:       8099,
+	SeedPeers: []Peer{
+		{Address: "172.31.36.40:8099", Type: "full", Mining: true},
+		{Address: "172.31.36.29:8099", Type: "full", Mining: true},
+		{Address: "172.31.36.31:8099", Type: "full", Mining: false},
+		{Address: "172.31.36.30:8099", Type: "full", Mining: false},
+	},
+
+	AddressVersion: 0x00,
+	Bech32HRP:      "pc",
+	HDCoinType:     0,
+
+	PrivateKeyVersion: 0x80,
+
+	GenesisCoinbaseData: "The Times 03/Jan/2009 Chancellor on brink of second bailout for banks",
+
+	PowLimit:           mainPowLimit,
+	PowLimitBits:       BigToCompact(mainPowLimit),
+	TargetBlockSpacing: 30,
+	RetargetInterval:   10,
+	MaxRetargetFactor:  4,
+
+	InitialSubsidy:   10,
+	HalvingInterval:  100000,
+	MaxSupply:        1800000,
+	CoinbaseMaturity: 10,
+}
+
+// TestNetParams 测试网参数，难度更低，奖励减半更快
+var TestNetParams = ChainParams{
+	Name:       "testnet",
+	Magic:      0x7063746e, //"pctn"
+	DataSubdir: "testnet",
+	Port:       18099,
+	SeedPeers:  nil,
+
+	AddressVersion: 0x6f,
+	Bech32HRP:      "tpc",
+	HDCoinType:     1,
+
+	PrivateKeyVersion: 0xef,
+
+	GenesisCoinbaseData: "publicChain testnet genesis",
+
+	PowLimit:           testPowLimit,
+	PowLimitBits:       BigToCompact(testPowLimit),
+	TargetBlockSpacing: 30,
+	RetargetInterval:   10,
+	MaxRetargetFactor:  4,
+
+	InitialSubsidy:   10,
+	HalvingInterval:  1000,
+	MaxSupply:        18000,
+	CoinbaseMaturity: 10,
+}
+
+// RegTestParams 回归测试网参数，难度极低且不调整，coinbase下一个区块就可以花费
+var RegTestParams = ChainParams{
+	Name:       "regtest",
+	Magic:      0x70637274, //"pcrt"
+	DataSubdir: "regtest",
+	Port:       18199,
+	SeedPeers:  nil,
+
+	AddressVersion: 0x6f,
+	Bech32HRP:      "pcrt",
+	HDCoinType:     1,
+
+	PrivateKeyVersion: 0xef,
+
+	GenesisCoinbaseData: "publicChain regtest genesis",
+
+	PowLimit:           regTestPowLimit,
+	PowLimitBits:       BigToCompact(regTestPowLimit),
+	TargetBlockSpacing: 30,
+	RetargetInterval:   10,
+	MaxRetargetFactor:  4,
+	NoRetargeting:      true,
+
+	InitialSubsidy:   10,
+	HalvingInterval:  150,
+	MaxSupply:        3000,
+	CoinbaseMaturity: 1,
+}
+
+// activeNetParams 当前使用的网络参数，由 -network 选项选择
+var activeNetParams = &MainNetParams
+
+// selectNetwork switches the active network parameters by network name
+func selectNetwork(name string) error {
+	for _, params := range []*ChainParams{&MainNetParams, &TestNetParams, &RegTestParams} {
+		if params.Name == name {
+			activeNetParams = params
+			return nil
+		}
+	}
+
+	return fmt.Errorf("unknown network %q, expected mainnet, testnet or regtest", name)
+}
@@ -26,13 +26,13 @@ type Peers struct {
 
 //加载本地的对等节点列表
 func LoadPeersFromFile() (*Peers, error) {
-	if _, err := os.Stat(PeerFile); os.IsNotExist(err) {
+	if _, err := os.Stat(peerPath()); os.IsNotExist(err) {
 		peers := getSeedPeers()
 		peers.SaveToFile()
 		return peers, nil
 	}
 
-	fileContent, err := ioutil.ReadFile(PeerFile)
+	fileContent, err := ioutil.ReadFile(peerPath())
 	if err != nil {
 		log.Panic(err)
 	}
@@ -60,33 +60,14 @@ func (p Peers) SaveToFile() {
 		log.Panic(err)
 	}
 
-	err = ioutil.WriteFile(PeerFile, content.Bytes(), 0644)
+	err = ioutil.WriteFile(peerPath(), content.Bytes(), 0644)
 	if err != nil {
 		log.Panic(err)
 	}
 }
 
+//当前网络的种子节点
 func getSeedPeers() *Peers {
-	var seedPeers [4]Peer
-	seedPeers[0] = Peer{
-		Address: "172.31.36.40:8099",
-		Type:    "full",
-		Mining:  true,
-	}
-	seedPeers[1] = Peer{
-		Address: "172.31.36.29:8099",
-		Type:    "full",
-		Mining:  true,
-	}
-	seedPeers[2] = Peer{
-		Address: "172.31.36.31:8099",
-		Type:    "full",
-		Mining:  false,
-	}
-	seedPeers[3] = Peer{
-		Address: "172.31.36.30:8099",
-		Type:    "full",
-		Mining:  false,
-	}
-	return &Peers{PeerList: seedPeers[:]}
+	seedPeers := append([]Peer{}, activeNetParams.SeedPeers...)
+	return &Peers{PeerList: seedPeers}
 }
@@ -1,11 +1,11 @@
 package main
 
 import (
-	"bytes"
 	"crypto/sha256"
-	"fmt"
+	"encoding/binary"
 	"math"
 	"math/big"
+	"sync/atomic"
 )
 
 /**
@@ -24,74 +24,71 @@ import (
 */
 
 var (
-	maxNonce = math.MaxInt64 //计数器最大值,对pow的次数进行限制
+	maxNonce uint64 = math.MaxUint32 //计数器最大值,对pow的次数进行限制
 )
 
+const checkStopInterval = 1 << 14 //每计算多少次Hash检查一次是否停止
+
 /**
 在比特币中，当一个块被挖出来以后，“target bits” 代表了区块头里存储的难度，也就是开头有多少个 0。
-这里的 24 指的是算出来的哈希前 24 位必须是 0，如果用 16 进制表示，就是前 6 位必须是 0，这一点从最后的输出可以看出来
+主网的最低难度要求算出来的哈希前 20 位必须是 0，也就是 ChainParams 中的 PowLimit，创世区块使用这个难度。
+之后每个区块的难度由难度调整算法决定，保存在区块的 Bits 字段中
 */
-const targetBits = 20
 
 type ProofOfWork struct {
 	block  *Block   //区块
 	target *big.Int //目标，这里使用了一个 大整数，我们会将哈希与目标进行比较：先把哈希转换成一个大整数，然后检测它是否小于目标。
 }
 
-// 构建并返回新的pow对象
+// 构建并返回新的pow对象，目标值取自区块的 Bits 字段
 func NewProofOfWork(b *Block) *ProofOfWork {
-	//将 big.Int 初始化为 1，16 进制形式为:0x10000000000000000000000000000000000000000000000000000000000
-	// 然后左移 256 - targetBits 位,16 进制形式为:0000010000000000000000000000000000000000000000000000000000000000
+	//Bits 是目标值的 compact 表示，比如最低难度 0x1e100000 展开后为 1 左移 256 - 20 位，
+	//16 进制形式为:0000100000000000000000000000000000000000000000000000000000000000
 	// 256 是一个 SHA-256 哈希的位数，我们将要使用的是 SHA-256 哈希算法。
 	//比如对"I like donuts"做Hash，结果为0fac49161af82ed938add1d8725835cc123a1a87b1b196488360e58d4bfb51e3
 	//显然比当前的target要大，所以不满足条件
 	//但是对"I like donutsca07ca"做Hash，结果为0000008b0f41ec78bab747864db66bcb9fb89920ee75f43fdaaeb5544f7f76ca
 	//显然比当前的target要小，所以满足条件，ca07ca 是nonce的 16 进制值，十进制的话是 13240266.也就是计算了13240266次Hash
-	target := big.NewInt(1)
-	target.Lsh(target, uint(256-targetBits))
+	target := CompactToBig(b.Bits)
 
 	pow := &ProofOfWork{b, target}
 
 	return pow
 }
 
-//准备数据,只需要将 target ，nonce 与 Block 进行合并
-func (pow *ProofOfWork) prepareData(nonce int) []byte {
-	data := bytes.Join(
-		[][]byte{
-			pow.block.PrevBlockHash,
-			pow.block.HashTransactions(),
-			IntToHex(pow.block.Timestamp),
-			IntToHex(int64(targetBits)),
-			IntToHex(int64(nonce)),
-		},
-		[]byte{},
-	)
-
-	return data
+// 准备数据,也就是把 nonce 填入区块头后序列化。
+// 交易已经通过 Merkle 根提交到区块头中，这里不需要再计算交易的Hash
+func (pow *ProofOfWork) prepareData(nonce uint32) []byte {
+	header := pow.block.BlockHeader
+	header.Nonce = nonce
+
+	return header.Serialize()
 }
 
-// 执行pow
-func (pow *ProofOfWork) Run() (int, []byte) {
+// 在 [start, maxNonce] 中以 step 为步长搜索满足目标的 nonce，多个 worker 用不同的 start 分摊 nonce 空间。
+// stop 被置为非0时提前返回；返回值依次为 nonce、Hash、是否找到、本次计算的Hash次数
+func (pow *ProofOfWork) search(start, step uint32, stop *int32) (uint32, []byte, bool, uint64) {
 	var hashInt big.Int //hash 的整形表示
-	var hash [32]byte
-	nonce := 0 //计数器初始值为0
+	var hashes uint64
+	data := pow.prepareData(0) //准备数据，之后只需要改写末尾的 nonce
 
-	fmt.Printf("Mining a new block\n")
-	for nonce < maxNonce {
-		data := pow.prepareData(nonce) //准备数据
+	for nonce := uint64(start); nonce <= maxNonce; nonce += uint64(step) {
+		//每计算一批Hash检查一次是否需要停止
+		if hashes%checkStopInterval == 0 && atomic.LoadInt32(stop) != 0 {
+			return 0, nil, false, hashes
+		}
 
-		hash = sha256.Sum256(data) //用 SHA-256 对数据进行哈希
-		hashInt.SetBytes(hash[:])  //将哈希转换成一个大整数
+		binary.LittleEndian.PutUint32(data[blockHeaderLen-4:], uint32(nonce))
+		hash := sha256.Sum256(data) //用 SHA-256 对数据进行哈希
+		hashInt.SetBytes(hash[:])   //将哈希转换成一个大整数
+		hashes++
 
 		if hashInt.Cmp(pow.target) == -1 { //将这个大整数与目标进行比较
-			break
-		} else {
-			nonce++
+			return uint32(nonce), hash[:], true, hashes
 		}
 	}
-	fmt.Printf("%x\n", hash)
-	return nonce, hash[:]
+
+	return 0, nil, false, hashes
 }
 
 // 验证区块的pow是否合法
@@ -103,7 +100,16 @@ func (pow *ProofOfWork) Validate() bool {
 	hash := sha256.Sum256(data) //对数据进行Hash计算
 	hashInt.SetBytes(hash[:])
 
-	isValid := hashInt.Cmp(pow.target) == -1 //比较
+	isValid := pow.target.Sign() > 0 && hashInt.Cmp(pow.target) == -1 //比较
 
 	return isValid
 }
+
+// Work 返回挖出一个满足当前目标的区块平均需要的Hash次数，即 2^256 / (target+1)
+// 分叉选择时比较的是各条链上区块Work的累加值，而不是高度
+func (pow *ProofOfWork) Work() *big.Int {
+	denominator := new(big.Int).Add(pow.target, big.NewInt(1))
+	numerator := new(big.Int).Lsh(big.NewInt(1), 256)
+
+	return numerator.Div(numerator, denominator)
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+/**
+区块和交易的二进制编码
+编码是确定的，和具体语言无关，其他语言的实现可以按同样的规则计算交易ID、签名Hash和区块Hash：
+  - 整数使用小端序，定长字段的宽度在各个类型的编码说明中给出
+  - 变长整数（varint）使用比特币的 CompactSize 格式：小于 0xfd 时为 1 字节，
+    否则为 0xfd/0xfe/0xff 加上 2/4/8 字节的小端序整数，必须使用最短的编码
+  - 字节数组编码为 varint 长度加上数据
+*/
+
+// errNonCanonical 表示数据的编码不是唯一的规范编码
+var errNonCanonical = errors.New("non-canonical encoding")
+
+// maxVarBytesLen 限制单个变长字段的长度，防止恶意数据导致分配过大的内存
+const maxVarBytesLen = 1 << 25
+
+func writeVarInt(buf *bytes.Buffer, n uint64) {
+	var b [9]byte
+
+	switch {
+	case n < 0xfd:
+		buf.WriteByte(byte(n))
+	case n <= 0xffff:
+		b[0] = 0xfd
+		binary.LittleEndian.PutUint16(b[1:], uint16(n))
+		buf.Write(b[:3])
+	case n <= 0xffffffff:
+		b[0] = 0xfe
+		binary.LittleEndian.PutUint32(b[1:], uint32(n))
+		buf.Write(b[:5])
+	default:
+		b[0] = 0xff
+		binary.LittleEndian.PutUint64(b[1:], n)
+		buf.Write(b[:9])
+	}
+}
+
+func writeVarBytes(buf *bytes.Buffer, data []byte) {
+	writeVarInt(buf, uint64(len(data)))
+	buf.Write(data)
+}
+
+func writeUint32(buf *bytes.Buffer, n uint32) {
+	var b [4]byte
+	binary.LittleEndian.PutUint32(b[:], n)
+	buf.Write(b[:])
+}
+
+func writeUint64(buf *bytes.Buffer, n uint64) {
+	var b [8]byte
+	binary.LittleEndian.PutUint64(b[:], n)
+	buf.Write(b[:])
+}
+
+// byteReader 按上面的规则读取编码后的数据，数据不足时返回 io.ErrUnexpectedEOF
+type byteReader struct {
+	data []byte
+	pos  int
+}
+
+func (r *byteReader) read(n int) ([]byte, error) {
+	if n < 0 || len(r.data)-r.pos < n {
+		return nil, io.ErrUnexpectedEOF
+	}
+	b := r.data[r.pos : r.pos+n]
+	r.pos += n
+
+	return b, nil
+}
+
+func (r *byteReader) readUint32() (uint32, error) {
+	b, err := r.read(4)
+	if err != nil {
+		return 0, err
+	}
+
+	return binary.LittleEndian.Uint32(b), nil
+}
+
+func (r *byteReader) readUint64() (uint64, error) {
+	b, err := r.read(8)
+	if err != nil {
+		return 0, err
+	}
+
+	return binary.LittleEndian.Uint64(b), nil
+}
+
+func (r *byteReader) readVarInt() (uint64, error) {
+	prefix, err := r.read(1)
+	if err != nil {
+		return 0, err
+	}
+
+	var n, min uint64
+	switch prefix[0] {
+	case 0xfd:
+		b, err := r.read(2)
+		if err != nil {
+			return 0, err
+		}
+		n, min = uint64(binary.LittleEndian.Uint16(b)), 0xfd
+	case 0xfe:
+		b, err := r.read(4)
+		if err != nil {
+			return 0, err
+		}
+		n, min = uint64(binary.LittleEndian.Uint32(b)), 0x10000
+	case 0xff:
+		b, err := r.read(8)
+		if err != nil {
+			return 0, err
+		}
+		n, min = binary.LittleEndian.Uint64(b), 0x100000000
+	default:
+		return uint64(prefix[0]), nil
+	}
+
+	if n < min {
+		return 0, errNonCanonical
+	}
+
+	return n, nil
+}
+
+func (r *byteReader) readVarBytes() ([]byte, error) {
+	n, err := r.readVarInt()
+	if err != nil {
+		return nil, err
+	}
+	if n > maxVarBytesLen {
+		return nil, errors.New("variable length field is too long")
+	}
+
+	b, err := r.read(int(n))
+	if err != nil {
+		return nil, err
+	}
+
+	return append([]byte{}, b...), nil
+}
+
+// done 检查数据是否已经全部读完
+func (r *byteReader) done() error {
+	if r.pos != len(r.data) {
+		return errors.New("unexpected trailing data")
+	}
+
+	return nil
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVarInt(t *testing.T) {
+	for _, n := range []uint64{0, 0xfc, 0xfd, 0xffff, 0x10000, 0xffffffff, 0x100000000} {
+		var buf bytes.Buffer
+		writeVarInt(&buf, n)
+
+		r := &byteReader{data: buf.Bytes()}
+		decoded, err := r.readVarInt()
+		assert.Nil(t, err)
+		assert.Equal(t, n, decoded)
+		assert.Nil(t, r.done())
+	}
+
+	//同一个数只能有一种编码
+	_, err := (&byteReader{data: []byte{0xfd, 0x10, 0x00}}).readVarInt()
+	assert.Equal(t, errNonCanonical, err)
+	_, err = (&byteReader{data: []byte{0xfe, 0xff, 0xff, 0x00, 0x00}}).readVarInt()
+	assert.Equal(t, errNonCanonical, err)
+}
+
+func TestTransactionSerialization(t *testing.T) {
+	wallet := NewWallet()
+	tx := Transaction{
+		Vin:  []TXInput{{[]byte{1, 2, 3}, 0, nil, wallet.PublicKey}},
+		Vout: []TXOutput{*NewTXOutput(5, string(wallet.GetAddress()))},
+	}
+	tx.Vin[0].Signature = bytes.Repeat([]byte{7}, 2*coordinateLen)
+	tx.ID = tx.unsignedHash()
+
+	data := tx.Serialize()
+	decoded := DeserializeTransaction(data)
+
+	assert.Equal(t, tx, decoded)
+	assert.Equal(t, data, decoded.Serialize())
+	assert.Panics(t, func() { DeserializeTransaction(append(data, 0)) })
+	assert.Panics(t, func() { DeserializeTransaction(data[:len(data)-1]) })
+}
+
+func TestBlockSerialization(t *testing.T) {
+	defer func(old *ChainParams) { activeNetParams = old }(activeNetParams)
+	activeNetParams = &RegTestParams
+
+	coinbase := NewCoinbaseTX(string(NewWallet().GetAddress()), "", 10)
+	genesis := NewGenesisBlock(coinbase)
+
+	data := genesis.Serialize()
+	decoded := DeserializeBlock(data)
+
+	assert.Equal(t, data, decoded.Serialize())
+	assert.Equal(t, genesis.Hash, decoded.Hash)
+	assert.Equal(t, genesis.Height, decoded.Height)
+	assert.Equal(t, coinbase.ID, decoded.Transactions[0].ID)
+	assert.Equal(t, []byte{}, decoded.PrevBlockHash)
+}
+
+func TestMalformedNetworkData(t *testing.T) {
+	defer func(old *ChainParams) { activeNetParams = old }(activeNetParams)
+	activeNetParams = &RegTestParams
+
+	wallet := NewWallet()
+	bc := CreateBlockchainWithStorage(NewMemoryStorage(), string(wallet.GetAddress()))
+	defer bc.db.Close()
+
+	coinbase := NewCoinbaseTX(string(wallet.GetAddress()), "", 1)
+	assert.Equal(t, coinbase.ID, DeserializeTransaction(coinbase.Serialize()).ID)
+
+	//截断的数据、多余的数据和无法解析的消息都被丢弃，节点不会退出
+	for _, data := range [][]byte{coinbase.Serialize()[:10], append(coinbase.Serialize(), 0), nil} {
+		handleTx(append(commandToBytes("txData"), gobEncode(TxData{Transaction: data})...), bc)
+		handleBlock(append(commandToBytes("blockData"), gobEncode(BlockData{Block: data})...), bc)
+	}
+	handleTx(append(commandToBytes("txData"), 1, 2, 3), bc)
+	handleBlock(append(commandToBytes("blockData"), 1, 2, 3), bc)
+	assert.Empty(t, mempool)
+	assert.Equal(t, 0, bc.GetBestHeight())
+}
@@ -2,6 +2,8 @@ package main
 
 import (
 	"bytes"
+	"context"
+	"encoding/binary"
 	"encoding/gob"
 	"encoding/hex"
 	"fmt"
@@ -13,17 +15,21 @@ import (
 )
 
 const protocol = "tcp"
-const listenPort = 8099
 
 //commandLength 表示命令名长度。
 // 节点之间交互的消息，在底层就是字节序列。前 20 个字节指定了命令名（比如 version），后面的字节会包含 gob 编码的消息结构
 const commandLength = 20
 
+//magicLength 表示网络标识的长度，每条消息前面都带有当前网络的 Magic，其他网络的消息会被丢弃
+const magicLength = 4
+
 var lock sync.Mutex //互斥锁
 
 var blocksInTransit = [][]byte{}           //保存已下载的块
 var mempool = make(map[string]Transaction) //交易内存池
 var Mining bool                            //节点是否开启挖矿
+var miningCancel context.CancelFunc        //中止当前的挖矿
+var miningAddress string                   //接收挖矿奖励的地址
 var node *Node                             //当前节点
 
 //比特币使用 Inv 来向其他节点展示当前节点有什么块和交易。
@@ -70,18 +76,18 @@ func StartServer() {
 	peers, err := LoadPeersFromFile()
 	//开启服务
 
-	ln, err := net.Listen(protocol, fmt.Sprintf("0.0.0.0:%d", listenPort))
+	ln, err := net.Listen(protocol, fmt.Sprintf("0.0.0.0:%d", activeNetParams.Port))
 	if err != nil {
 		log.Panic(err)
 	}
 	defer ln.Close()
 
 	//发送节点信息到其他节点，以便加入网络
-	fmt.Printf("当前机器的内网IP为：%s\n", fmt.Sprintf("%s:%d", GetInternalIp(), listenPort))
+	fmt.Printf("当前机器的内网IP为：%s\n", fmt.Sprintf("%s:%d", GetInternalIp(), activeNetParams.Port))
 	for _, peer := range peers.PeerList {
 		peerAddress := peer.Address
 		//自己的外网IP
-		if peerAddress == fmt.Sprintf("%s:%d", GetInternalIp(), listenPort) {
+		if peerAddress == fmt.Sprintf("%s:%d", GetInternalIp(), activeNetParams.Port) {
 			continue
 		}
 		fmt.Printf("正在连接至节点%s", peerAddress)
@@ -114,14 +120,19 @@ func UpdateNode(mining bool, bc *Blockchain) {
 	node = NewNode("full", mining, bc)
 }
 
-//发送数据
+//发送数据，数据前面加上当前网络的标识
 func sendData(addr string, data []byte) error {
 	conn, err := net.Dial(protocol, addr)
 	if err != nil {
 		return err
 	}
 	defer conn.Close()
-	_, err = io.Copy(conn, bytes.NewReader(data))
+
+	message := make([]byte, magicLength, magicLength+len(data))
+	binary.BigEndian.PutUint32(message, activeNetParams.Magic)
+	message = append(message, data...)
+
+	_, err = io.Copy(conn, bytes.NewReader(message))
 	return err
 }
 
@@ -289,7 +300,11 @@ func handleInv(request []byte, blockchain *Blockchain) {
 	if payload.Type == "tx" {
 		txID := payload.Items[0]
 
-		if mempool[hex.EncodeToString(txID)].ID == nil {
+		lock.Lock()
+		_, inMempool := mempool[hex.EncodeToString(txID)]
+		lock.Unlock()
+
+		if !inMempool {
 			sendGetData(payload.NodeInfo.Address, "tx", txID)
 		}
 	}
@@ -326,7 +341,9 @@ func handleGetData(request []byte, bc *Blockchain) {
 
 	if data.Type == "tx" {
 		txID := hex.EncodeToString(data.Hash)
+		lock.Lock()
 		tx := mempool[txID]
+		lock.Unlock()
 
 		sendTx(data.NodeInfo.Address, &tx)
 		// delete(mempool, txID)
@@ -343,8 +360,9 @@ func sendBlock(addr string, b *Block) {
 }
 
 //当接收到一个新块时，我们把它放到区块链里面。如果还有更多的区块需要下载，我们继续从上一个下载的块的那个节点继续请求。
-// 当最后把所有块都下载完后，对 UTXO 集进行重新索引。
-//TODO：并非无条件信任，我们应该在将每个块加入到区块链之前对它们进行验证。
+// 区块先经过 ValidateBlock 的共识检查，不合法的区块直接丢弃。
+// AddBlock 会根据累计工作量决定是否切换主链，并同步更新 UTXO 集。
+// 如果区块的父区块未知（对方处于另一条分叉上），则向对方请求父区块，直到接上本地的区块树。
 func handleBlock(request []byte, bc *Blockchain) {
 	lock.Lock()
 	defer lock.Unlock()
@@ -355,12 +373,16 @@ func handleBlock(request []byte, bc *Blockchain) {
 	dec := gob.NewDecoder(&buff)
 	err := dec.Decode(&blockData)
 	if err != nil {
-		log.Panic(err)
+		fmt.Println("丢弃无法解析的区块消息：", err)
+		return
 	}
 
-	blockBytes := blockData.Block
-	block := DeserializeBlock(blockBytes)
-	//验证区块有效性
+	//对方发来的数据不可信，解码失败时丢弃区块，不能让节点退出
+	block, err := decodeBlock(&byteReader{data: blockData.Block})
+	if err != nil {
+		fmt.Println("丢弃无法解码的区块：", err)
+		return
+	}
 	//判断区块是否已经存在
 	_, err = bc.GetBlock(block.Hash)
 	if err == nil {
@@ -369,28 +391,46 @@ func handleBlock(request []byte, bc *Blockchain) {
 	}
 
 	fmt.Println("Recevied a new block!")
-	bc.AddBlock(block)
-	//重新加载区块链
-	bc = NewBlockchain()
+	err = bc.ValidateBlock(block)
+	if err != nil && err != ErrOrphanBlock {
+		fmt.Println("拒绝区块：", err)
+		return
+	}
+
+	oldTip := bc.tip
+	disconnected, err := bc.AddBlock(block)
+	if err == ErrOrphanBlock {
+		fmt.Printf("区块%x的父区块不存在，向peer请求父区块\n", block.Hash)
+		sendGetData(blockData.NodeInfo.Address, "block", block.PrevBlockHash)
+		return
+	}
+	if err != nil {
+		fmt.Println("拒绝区块：", err)
+		return
+	}
 
 	fmt.Printf("Added block %x\n", block.Hash)
+	if bytes.Compare(oldTip, bc.tip) != 0 {
+		stopMining()
+	}
+	//链重组时断开的交易放回交易池，已经无效的交易在下次打包时被清除
+	for _, tx := range disconnected {
+		mempool[hex.EncodeToString(tx.ID)] = tx
+	}
 
 	if len(blocksInTransit) > 0 {
 		blockHash := blocksInTransit[0]
 		sendGetData(blockData.NodeInfo.Address, "block", blockHash)
 		blocksInTransit = blocksInTransit[1:]
-	} else {
-		UTXOSet := UTXOSet{bc}
-		UTXOSet.Update(block)
 	}
 }
 
 //发送交易数据
-func sendTx(addr string, tnx *Transaction) {
+func sendTx(addr string, tnx *Transaction) error {
 	data := TxData{*node, tnx.Serialize()}
 	payload := gobEncode(data)
 	request := append(commandToBytes("txData"), payload...)
-	sendData(addr, request)
+	return sendData(addr, request)
 }
 
 //处理其他节点发送过来的交易数据
@@ -402,14 +442,24 @@ func handleTx(request []byte, bc *Blockchain) {
 	dec := gob.NewDecoder(&buff)
 	err := dec.Decode(&txData)
 	if err != nil {
-		log.Panic(err)
+		fmt.Println("丢弃无法解析的交易消息：", err)
+		return
 	}
 
-	txBytes := txData.Transaction
-	tx := DeserializeTransaction(txBytes)
+	r := &byteReader{data: txData.Transaction}
+	tx, err := decodeTransaction(r)
+	if err == nil {
+		err = r.done()
+	}
+	if err != nil {
+		fmt.Println("丢弃无法解码的交易：", err)
+		return
+	}
 	//首先要做的事情是将新交易放到内存池中
 	//TODO:在将交易放到内存池之前，必要对其进行验证
+	lock.Lock()
 	mempool[hex.EncodeToString(tx.ID)] = tx
+	lock.Unlock()
 
 	///**
 	//收到新的交易
@@ -474,10 +524,18 @@ func handleTx(request []byte, bc *Blockchain) {
 //处理其他节点的请求
 func handleConnection(conn net.Conn, bc *Blockchain) {
 	fmt.Println("远程地址：", conn.RemoteAddr())
-	request, err := ioutil.ReadAll(conn)
+	message, err := ioutil.ReadAll(conn)
 	if err != nil {
 		log.Panic(err)
 	}
+	//检查网络标识，拒绝其他网络的节点
+	if len(message) < magicLength+commandLength || binary.BigEndian.Uint32(message) != activeNetParams.Magic {
+		fmt.Println("丢弃其他网络或格式错误的消息")
+		conn.Close()
+		return
+	}
+	request := message[magicLength:]
+
 	//提取出命令名
 	command := bytesToCommand(request[:commandLength])
 	fmt.Printf("Received %s command\n", command)
@@ -508,36 +566,67 @@ func handleConnection(conn net.Conn, bc *Blockchain) {
 }
 
 func mining(bc *Blockchain) {
-	fmt.Println("开始挖矿")
+	fmt.Println("开始挖矿，奖励地址：", miningAddress)
 	for Mining {
 		//如果节点开启挖矿，则在挖矿的同时，不停的取交易池的数据打包进区块
-		//挖矿成功后广播给peer
-		wallets, err := NewWallets()
+		//挖矿成功后广播给peer，挖矿奖励发送到 miningAddress
+		//按交易费率从交易池中挑选交易，coinbase 领取区块奖励和全部交易费
+		lock.Lock()
+		template := bc.AssembleBlock(mempool)
+		for _, id := range template.Invalid {
+			delete(mempool, id)
+		}
+		lock.Unlock()
+
+		cbTx := NewCoinbaseTX(miningAddress, "", GetBlockSubsidy(template.Height)+template.Fees)
+		txs := []*Transaction{cbTx}
+		txs = append(txs, template.Transactions...)
+
+		//收到新区块导致链顶变化时，handleBlock 会调用 miningCancel 中止当前的挖矿
+		ctx, cancel := context.WithCancel(context.Background())
+		lock.Lock()
+		miningCancel = cancel
+		lock.Unlock()
+
+		newBlock, err := bc.SolveBlock(ctx, txs)
+		cancel()
 		if err != nil {
-			log.Panic(err)
+			fmt.Println("链顶已经变化，重新开始挖矿：", err)
+			continue
 		}
 
-		UTXOSet := UTXOSet{bc}
-		cbTx := NewCoinbaseTX(wallets.CreateWallet(), "")
-		txs := []*Transaction{}
-		txs = append(txs, cbTx)
-		for hash, transaction := range mempool {
-			txs = append(txs, &transaction)
-			delete(mempool, hash)
+		//handleBlock 也在 lock 中修改链顶和UTXO集，加入区块时必须持有 lock
+		lock.Lock()
+		_, err = bc.AddBlock(newBlock)
+		if err == nil {
+			for _, tx := range template.Transactions {
+				delete(mempool, hex.EncodeToString(tx.ID))
+			}
 		}
-		newBlock := bc.MineBlock(txs)
-		UTXOSet.Update(newBlock)
+		lock.Unlock()
+		if err != nil {
+			fmt.Println("挖出的区块无法加入区块链：", err)
+			continue
+		}
+		fmt.Println("挖矿成功，最新区块高度为：", newBlock.Height)
 		go shareMyBooty(bc)
 	}
 }
 
+// stopMining 中止正在进行的挖矿，调用方需要持有 lock
+func stopMining() {
+	if miningCancel != nil {
+		miningCancel()
+	}
+}
+
 //挖矿成功，通知其他节点来同步数据
 func shareMyBooty(bc *Blockchain) {
 	peers, _ := LoadPeersFromFile()
 	for _, peer := range peers.PeerList {
 		peerAddress := peer.Address
 		//自己的外网IP
-		if peerAddress == fmt.Sprintf("%s:%d", GetInternalIp(), listenPort) {
+		if peerAddress == fmt.Sprintf("%s:%d", GetInternalIp(), activeNetParams.Port) {
 			continue
 		}
 		UpdateNode(Mining, bc)
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"errors"
+)
+
+/**
+区块链的存储接口
+区块、链顶、UTXO集和各种索引都保存在不同的表（bucket）中，所有读写都在事务中进行：
+View 中只读，Update 中的修改在函数返回nil时一起提交，返回错误时全部回滚。
+boltStorage 把数据保存在bolt数据库文件中，memoryStorage 把数据保存在内存中，用于测试
+*/
+
+// ErrBucketNotFound is returned when deleting a bucket that does not exist
+var ErrBucketNotFound = errors.New("bucket not found")
+
+// ErrBucketExists is returned when creating a bucket that already exists
+var ErrBucketExists = errors.New("bucket already exists")
+
+// Storage is a transactional key/value store organized in buckets
+type Storage interface {
+	View(fn func(tx StorageTx) error) error
+	Update(fn func(tx StorageTx) error) error
+	Close() error
+}
+
+// StorageTx is a read-only or read-write storage transaction
+type StorageTx interface {
+	// Bucket returns nil if the bucket does not exist
+	Bucket(name []byte) StorageBucket
+	CreateBucket(name []byte) (StorageBucket, error)
+	CreateBucketIfNotExists(name []byte) (StorageBucket, error)
+	DeleteBucket(name []byte) error
+}
+
+// StorageBucket is a collection of key/value pairs.
+// Slices returned by Get and the cursor are only valid during the transaction and must not be modified
+type StorageBucket interface {
+	// Get returns nil if the key does not exist
+	Get(key []byte) []byte
+	Put(key []byte, value []byte) error
+	Delete(key []byte) error
+	Cursor() StorageCursor
+}
+
+// StorageCursor iterates over the keys of a bucket in byte order.
+// All methods return a nil key when there are no more keys
+type StorageCursor interface {
+	First() ([]byte, []byte)
+	Next() ([]byte, []byte)
+	Seek(seek []byte) ([]byte, []byte)
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"sort"
+	"sync"
+)
+
+// memoryStorage 把所有表保存在内存中的存储，进程退出后数据丢失。
+// 读写事务直接修改数据，同时记录每次修改的撤销操作，返回错误或者panic时按相反的顺序撤销，
+// 这样事务的开销只和它修改的数据量有关
+type memoryStorage struct {
+	lock    sync.RWMutex
+	buckets map[string]map[string][]byte
+	closed  bool
+}
+
+// NewMemoryStorage creates an empty in-memory storage
+func NewMemoryStorage() Storage {
+	return &memoryStorage{buckets: make(map[string]map[string][]byte)}
+}
+
+var errStorageClosed = errors.New("storage is closed")
+
+func (s *memoryStorage) View(fn func(tx StorageTx) error) error {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	if s.closed {
+		return errStorageClosed
+	}
+
+	return fn(&memoryTx{buckets: s.buckets})
+}
+
+func (s *memoryStorage) Update(fn func(tx StorageTx) error) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.closed {
+		return errStorageClosed
+	}
+
+	tx := &memoryTx{buckets: s.buckets, writable: true}
+	committed := false
+	defer func() {
+		if !committed {
+			tx.rollback()
+		}
+	}()
+
+	err := fn(tx)
+	if err != nil {
+		return err
+	}
+	committed = true
+
+	return nil
+}
+
+func (s *memoryStorage) Close() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.closed = true
+	return nil
+}
+
+type memoryTx struct {
+	buckets  map[string]map[string][]byte
+	writable bool
+	undo     []func() //撤销已经做过的修改，按相反的顺序执行
+}
+
+func (t *memoryTx) rollback() {
+	for i := len(t.undo) - 1; i >= 0; i-- {
+		t.undo[i]()
+	}
+	t.undo = nil
+}
+
+var errTxNotWritable = errors.New("transaction is not writable")
+
+func (t *memoryTx) Bucket(name []byte) StorageBucket {
+	data, ok := t.buckets[string(name)]
+	if !ok {
+		return nil
+	}
+
+	return &memoryBucket{data, t}
+}
+
+func (t *memoryTx) CreateBucket(name []byte) (StorageBucket, error) {
+	if !t.writable {
+		return nil, errTxNotWritable
+	}
+	if _, ok := t.buckets[string(name)]; ok {
+		return nil, ErrBucketExists
+	}
+
+	t.buckets[string(name)] = make(map[string][]byte)
+	t.undo = append(t.undo, func() { delete(t.buckets, string(name)) })
+
+	return t.Bucket(name), nil
+}
+
+func (t *memoryTx) CreateBucketIfNotExists(name []byte) (StorageBucket, error) {
+	if b := t.Bucket(name); b != nil {
+		return b, nil
+	}
+
+	return t.CreateBucket(name)
+}
+
+func (t *memoryTx) DeleteBucket(name []byte) error {
+	if !t.writable {
+		return errTxNotWritable
+	}
+	data, ok := t.buckets[string(name)]
+	if !ok {
+		return ErrBucketNotFound
+	}
+
+	delete(t.buckets, string(name))
+	t.undo = append(t.undo, func() { t.buckets[string(name)] = data })
+
+	return nil
+}
+
+type memoryBucket struct {
+	data map[string][]byte
+	tx   *memoryTx
+}
+
+func (b *memoryBucket) Get(key []byte) []byte {
+	return b.data[string(key)]
+}
+
+func (b *memoryBucket) Put(key []byte, value []byte) error {
+	if !b.tx.writable {
+		return errTxNotWritable
+	}
+
+	b.saveUndo(string(key))
+	b.data[string(key)] = append([]byte{}, value...)
+	return nil
+}
+
+func (b *memoryBucket) Delete(key []byte) error {
+	if !b.tx.writable {
+		return errTxNotWritable
+	}
+
+	b.saveUndo(string(key))
+	delete(b.data, string(key))
+	return nil
+}
+
+// saveUndo 记录key修改之前的值，回滚时恢复
+func (b *memoryBucket) saveUndo(key string) {
+	data := b.data
+	old, existed := data[key]
+
+	b.tx.undo = append(b.tx.undo, func() {
+		if existed {
+			data[key] = old
+		} else {
+			delete(data, key)
+		}
+	})
+}
+
+// Cursor 创建游标时对key排序，遍历过程中被删除的key会被跳过
+func (b *memoryBucket) Cursor() StorageCursor {
+	keys := make([]string, 0, len(b.data))
+	for k := range b.data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	return &memoryCursor{b, keys, 0}
+}
+
+type memoryCursor struct {
+	bucket *memoryBucket
+	keys   []string
+	pos    int
+}
+
+func (c *memoryCursor) First() ([]byte, []byte) {
+	c.pos = 0
+	return c.current()
+}
+
+func (c *memoryCursor) Next() ([]byte, []byte) {
+	c.pos++
+	return c.current()
+}
+
+func (c *memoryCursor) Seek(seek []byte) ([]byte, []byte) {
+	c.pos = sort.Search(len(c.keys), func(i int) bool {
+		return bytes.Compare([]byte(c.keys[i]), seek) >= 0
+	})
+	return c.current()
+}
+
+// current 返回游标当前位置的key和value，跳过已经被删除的key
+func (c *memoryCursor) current() ([]byte, []byte) {
+	for ; c.pos < len(c.keys); c.pos++ {
+		if v, ok := c.bucket.data[c.keys[c.pos]]; ok {
+			return []byte(c.keys[c.pos]), v
+		}
+	}
+
+	return nil, nil
+}
@@ -0,0 +1,41 @@
+package main
+
+/**
+区块奖励
+和比特币一样，区块奖励每隔 HalvingInterval 个区块减半一次，奖励减到 0 以后不再发行新币。
+所有区块奖励加起来不能超过 MaxSupply，超过上限的部分不再发行。这些参数都在当前网络的 ChainParams 中。
+注意奖励之外矿工还可以领取区块中交易的交易费，交易费不是新发行的币
+*/
+
+// GetBlockSubsidy returns the number of new coins the block at height may create
+func GetBlockSubsidy(height int) int {
+	if height < 0 {
+		return 0
+	}
+
+	return IssuedSupply(height) - IssuedSupply(height-1)
+}
+
+// IssuedSupply returns the number of coins created by the blocks from genesis up to height
+func IssuedSupply(height int) int {
+	params := activeNetParams
+	issued := 0
+	reward := params.InitialSubsidy
+	blocks := height + 1
+
+	for blocks > 0 && reward > 0 {
+		n := params.HalvingInterval
+		if blocks < n {
+			n = blocks
+		}
+		issued += n * reward
+		blocks -= n
+		reward /= 2
+	}
+
+	if issued > params.MaxSupply {
+		issued = params.MaxSupply
+	}
+
+	return issued
+}
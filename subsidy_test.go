@@ -0,0 +1,38 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetBlockSubsidy(t *testing.T) {
+	params := activeNetParams
+
+	assert.Equal(t, params.InitialSubsidy, GetBlockSubsidy(0))
+	assert.Equal(t, params.InitialSubsidy, GetBlockSubsidy(params.HalvingInterval-1))
+	assert.Equal(t, params.InitialSubsidy/2, GetBlockSubsidy(params.HalvingInterval))
+	assert.Equal(t, params.InitialSubsidy/4, GetBlockSubsidy(2*params.HalvingInterval))
+	assert.Equal(t, 0, GetBlockSubsidy(100*params.HalvingInterval))
+}
+
+func TestIssuedSupply(t *testing.T) {
+	params := activeNetParams
+
+	assert.Equal(t, 0, IssuedSupply(-1))
+	assert.Equal(t, params.InitialSubsidy, IssuedSupply(0))
+	assert.Equal(t, params.InitialSubsidy*params.HalvingInterval, IssuedSupply(params.HalvingInterval-1))
+	assert.True(t, IssuedSupply(100*params.HalvingInterval) <= params.MaxSupply)
+}
+
+func TestSupplyCap(t *testing.T) {
+	defer func(old *ChainParams) { activeNetParams = old }(activeNetParams)
+	params := MainNetParams
+	params.MaxSupply = params.InitialSubsidy*3 + 4
+	activeNetParams = &params
+
+	assert.Equal(t, params.InitialSubsidy, GetBlockSubsidy(2))
+	assert.Equal(t, 4, GetBlockSubsidy(3))
+	assert.Equal(t, 0, GetBlockSubsidy(4))
+	assert.Equal(t, params.MaxSupply, IssuedSupply(10))
+}
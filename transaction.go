@@ -6,16 +6,17 @@ import (
 	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/sha256"
+	"errors"
 	"math/big"
 	"strings"
 
-	"encoding/gob"
 	"encoding/hex"
 	"fmt"
 	"log"
 )
 
-const subsidy = 10
+// txVersion 交易编码格式的版本号，写在编码后的交易开头
+const txVersion = 1
 
 // Transaction represents a Bitcoin transaction
 type Transaction struct {
@@ -30,26 +31,64 @@ func (tx Transaction) IsCoinbase() bool {
 }
 
 // Serialize returns a serialized Transaction
+// 编码格式：版本号（4字节）、输入个数（varint）、各个输入、输出个数（varint）、各个输出。
+// ID不参与编码，它由交易内容计算得到
 func (tx Transaction) Serialize() []byte {
-	var encoded bytes.Buffer
+	var buf bytes.Buffer
 
-	enc := gob.NewEncoder(&encoded)
-	err := enc.Encode(tx)
-	if err != nil {
-		log.Panic(err)
+	tx.serialize(&buf)
+
+	return buf.Bytes()
+}
+
+func (tx *Transaction) serialize(buf *bytes.Buffer) {
+	writeUint32(buf, txVersion)
+
+	writeVarInt(buf, uint64(len(tx.Vin)))
+	for i := range tx.Vin {
+		tx.Vin[i].serialize(buf)
 	}
 
-	return encoded.Bytes()
+	writeVarInt(buf, uint64(len(tx.Vout)))
+	for i := range tx.Vout {
+		tx.Vout[i].serialize(buf)
+	}
 }
 
 // Hash returns the hash of the Transaction
 func (tx *Transaction) Hash() []byte {
-	var hash [32]byte
+	hash := sha256.Sum256(tx.Serialize())
 
+	return hash[:]
+}
+
+// unsignedHash returns the hash of the Transaction with the input signatures removed,
+// the transaction ID is computed before signing so this is what it commits to
+func (tx *Transaction) unsignedHash() []byte {
 	txCopy := *tx
-	txCopy.ID = []byte{}
+	txCopy.Vin = make([]TXInput, len(tx.Vin))
 
-	hash = sha256.Sum256(txCopy.Serialize())
+	for i, vin := range tx.Vin {
+		txCopy.Vin[i] = TXInput{vin.Txid, vin.Vout, nil, vin.PubKey}
+	}
+
+	return txCopy.Hash()
+}
+
+// signatureHash 返回第inID个输入需要签名的Hash，spent[i] 是第i个输入花费的输出：
+// 去掉所有输入的签名和公钥，再把第inID个输入的公钥换成被花费输出的公钥Hash，编码这个副本，
+// 后面再加上所有被花费输出的金额，对结果做Hash。
+// 签名包含被花费输出的金额，离线签名时如果有人谎报了输入的金额（从而谎报了交易费），签名就会无效
+func (tx *Transaction) signatureHash(inID int, spent []TXOutput) []byte {
+	var buf bytes.Buffer
+
+	txCopy := tx.TrimmedCopy()
+	txCopy.Vin[inID].PubKey = spent[inID].PubKeyHash
+	txCopy.serialize(&buf)
+	for _, out := range spent {
+		writeUint64(&buf, uint64(int64(out.Value)))
+	}
+	hash := sha256.Sum256(buf.Bytes())
 
 	return hash[:]
 }
@@ -66,24 +105,27 @@ func (tx *Transaction) Sign(privKey ecdsa.PrivateKey, prevTXs map[string]Transac
 		}
 	}
 
-	txCopy := tx.TrimmedCopy()
-
-	for inID, vin := range txCopy.Vin {
+	var spent []TXOutput
+	for _, vin := range tx.Vin {
 		prevTx := prevTXs[hex.EncodeToString(vin.Txid)]
-		txCopy.Vin[inID].Signature = nil
-		txCopy.Vin[inID].PubKey = prevTx.Vout[vin.Vout].PubKeyHash
+		spent = append(spent, prevTx.Vout[vin.Vout])
+	}
 
-		dataToSign := fmt.Sprintf("%x\n", txCopy)
+	for inID := range tx.Vin {
+		tx.signInput(inID, privKey, spent)
+	}
+}
 
-		r, s, err := ecdsa.Sign(rand.Reader, &privKey, []byte(dataToSign))
-		if err != nil {
-			log.Panic(err)
-		}
-		signature := append(r.Bytes(), s.Bytes()...)
+// signInput 签名第inID个输入，spent[i] 是第i个输入花费的输出
+func (tx *Transaction) signInput(inID int, privKey ecdsa.PrivateKey, spent []TXOutput) {
+	hash := tx.signatureHash(inID, spent)
 
-		tx.Vin[inID].Signature = signature
-		txCopy.Vin[inID].PubKey = nil
+	r, s, err := ecdsa.Sign(rand.Reader, &privKey, hash)
+	if err != nil {
+		log.Panic(err)
 	}
+
+	tx.Vin[inID].Signature = append(padBytes(r.Bytes(), coordinateLen), padBytes(s.Bytes(), coordinateLen)...)
 }
 
 // String returns a human-readable representation of a transaction
@@ -140,40 +182,57 @@ func (tx *Transaction) Verify(prevTXs map[string]Transaction) bool {
 		}
 	}
 
-	txCopy := tx.TrimmedCopy()
+	var spent []TXOutput
+	for _, vin := range tx.Vin {
+		prevTx := prevTXs[hex.EncodeToString(vin.Txid)]
+		if vin.Vout < 0 || vin.Vout >= len(prevTx.Vout) {
+			return false
+		}
+		spent = append(spent, prevTx.Vout[vin.Vout])
+	}
+
+	return tx.verifyInputs(spent)
+}
+
+// verifyInputs verifies input signatures against the outputs they spend,
+// spent[i] is the output referenced by tx.Vin[i]
+// 签名是定长的 r||s，公钥是定长的 X||Y，每个数都是32字节大端序
+func (tx *Transaction) verifyInputs(spent []TXOutput) bool {
 	curve := elliptic.P256()
 
 	for inID, vin := range tx.Vin {
-		prevTx := prevTXs[hex.EncodeToString(vin.Txid)]
-		txCopy.Vin[inID].Signature = nil
-		txCopy.Vin[inID].PubKey = prevTx.Vout[vin.Vout].PubKeyHash
+		//输入中的公钥必须和被花费输出锁定的公钥Hash一致
+		if !vin.UsesKey(spent[inID].PubKeyHash) {
+			return false
+		}
+		if len(vin.Signature) != 2*coordinateLen || len(vin.PubKey) != 2*coordinateLen {
+			return false
+		}
 
 		r := big.Int{}
 		s := big.Int{}
-		sigLen := len(vin.Signature)
-		r.SetBytes(vin.Signature[:(sigLen / 2)])
-		s.SetBytes(vin.Signature[(sigLen / 2):])
+		r.SetBytes(vin.Signature[:coordinateLen])
+		s.SetBytes(vin.Signature[coordinateLen:])
 
 		x := big.Int{}
 		y := big.Int{}
-		keyLen := len(vin.PubKey)
-		x.SetBytes(vin.PubKey[:(keyLen / 2)])
-		y.SetBytes(vin.PubKey[(keyLen / 2):])
+		x.SetBytes(vin.PubKey[:coordinateLen])
+		y.SetBytes(vin.PubKey[coordinateLen:])
 
-		dataToVerify := fmt.Sprintf("%x\n", txCopy)
+		hash := tx.signatureHash(inID, spent)
 
-		rawPubKey := ecdsa.PublicKey{curve, &x, &y}
-		if ecdsa.Verify(&rawPubKey, []byte(dataToVerify), &r, &s) == false {
+		rawPubKey := ecdsa.PublicKey{Curve: curve, X: &x, Y: &y}
+		if ecdsa.Verify(&rawPubKey, hash, &r, &s) == false {
 			return false
 		}
-		txCopy.Vin[inID].PubKey = nil
 	}
 
 	return true
 }
 
-// NewCoinbaseTX creates a new coinbase transaction
-func NewCoinbaseTX(to, data string) *Transaction {
+// NewCoinbaseTX creates a new coinbase transaction paying value to the address,
+// value is the block subsidy plus the fees of the transactions in the block
+func NewCoinbaseTX(to, data string, value int) *Transaction {
 	if data == "" {
 		randData := make([]byte, 20)
 		_, err := rand.Read(randData)
@@ -185,61 +244,86 @@ func NewCoinbaseTX(to, data string) *Transaction {
 	}
 
 	txin := TXInput{[]byte{}, -1, nil, []byte(data)}
-	txout := NewTXOutput(subsidy, to)
+	txout := NewTXOutput(value, to)
 	tx := Transaction{nil, []TXInput{txin}, []TXOutput{*txout}}
-	tx.ID = tx.Hash()
+	tx.ID = tx.unsignedHash()
 
 	return &tx
 }
 
 // NewUTXOTransaction creates a new transaction
-func NewUTXOTransaction(wallet *Wallet, to string, amount int, UTXOSet *UTXOSet) *Transaction {
-	var inputs []TXInput
-	var outputs []TXOutput
-
-	pubKeyHash := HashPubKey(wallet.PublicKey)
-	acc, validOutputs := UTXOSet.FindSpendableOutputs(pubKeyHash, amount)
-
-	if acc < amount {
-		log.Panic("ERROR: Not enough funds")
-	}
-
-	// Build a list of inputs
-	for txid, outs := range validOutputs {
-		txID, err := hex.DecodeString(txid)
-		if err != nil {
-			log.Panic(err)
-		}
-
-		for _, out := range outs {
-			input := TXInput{txID, out, nil, wallet.PublicKey}
-			inputs = append(inputs, input)
-		}
-	}
-
-	// Build a list of outputs
+// 交易费不单独记录，等于输入总额减去输出总额，由打包交易的矿工在coinbase中领取
+func NewUTXOTransaction(wallet *Wallet, to string, amount, fee int, UTXOSet *UTXOSet) *Transaction {
 	from := fmt.Sprintf("%s", wallet.GetAddress())
-	outputs = append(outputs, *NewTXOutput(amount, to))
-	if acc > amount {
-		outputs = append(outputs, *NewTXOutput(acc-amount, from)) // a change
-	}
 
-	tx := Transaction{nil, inputs, outputs}
-	tx.ID = tx.Hash()
-	UTXOSet.Blockchain.SignTransaction(&tx, wallet.PrivateKey)
+	rtx, err := NewRawTransaction(from, to, amount, fee, UTXOSet)
+	if err != nil {
+		log.Panic("ERROR: ", err)
+	}
+	rtx.Sign(wallet)
 
-	return &tx
+	return &rtx.Tx
 }
 
 // DeserializeTransaction deserializes a transaction
 func DeserializeTransaction(data []byte) Transaction {
-	var transaction Transaction
+	r := &byteReader{data: data}
 
-	decoder := gob.NewDecoder(bytes.NewReader(data))
-	err := decoder.Decode(&transaction)
+	transaction, err := decodeTransaction(r)
+	if err == nil {
+		err = r.done()
+	}
 	if err != nil {
 		log.Panic(err)
 	}
 
 	return transaction
 }
+
+// decodeTransaction 读取一笔编码后的交易并计算它的ID
+func decodeTransaction(r *byteReader) (Transaction, error) {
+	var tx Transaction
+
+	version, err := r.readUint32()
+	if err != nil {
+		return tx, err
+	}
+	if version != txVersion {
+		return tx, fmt.Errorf("unknown transaction version %d", version)
+	}
+
+	count, err := r.readVarInt()
+	if err != nil {
+		return tx, err
+	}
+	//每个输入至少占7个字节，用剩余的数据长度限制个数
+	if count > uint64(len(r.data)-r.pos) {
+		return tx, errors.New("too many transaction inputs")
+	}
+	for i := uint64(0); i < count; i++ {
+		in, err := decodeTXInput(r)
+		if err != nil {
+			return tx, err
+		}
+		tx.Vin = append(tx.Vin, in)
+	}
+
+	count, err = r.readVarInt()
+	if err != nil {
+		return tx, err
+	}
+	if count > uint64(len(r.data)-r.pos) {
+		return tx, errors.New("too many transaction outputs")
+	}
+	for i := uint64(0); i < count; i++ {
+		out, err := decodeTXOutput(r)
+		if err != nil {
+			return tx, err
+		}
+		tx.Vout = append(tx.Vout, out)
+	}
+
+	tx.ID = tx.unsignedHash()
+
+	return tx, nil
+}
@@ -16,3 +16,34 @@ func (in *TXInput) UsesKey(pubKeyHash []byte) bool {
 
 	return bytes.Compare(lockingHash, pubKeyHash) == 0
 }
+
+// serialize 编码输入：Txid（varbytes）、Vout（4字节，coinbase为0xffffffff）、Signature（varbytes）、PubKey（varbytes）
+func (in *TXInput) serialize(buf *bytes.Buffer) {
+	writeVarBytes(buf, in.Txid)
+	writeUint32(buf, uint32(int32(in.Vout)))
+	writeVarBytes(buf, in.Signature)
+	writeVarBytes(buf, in.PubKey)
+}
+
+// decodeTXInput 读取一个编码后的输入
+func decodeTXInput(r *byteReader) (TXInput, error) {
+	var in TXInput
+	var err error
+
+	in.Txid, err = r.readVarBytes()
+	if err != nil {
+		return in, err
+	}
+	vout, err := r.readUint32()
+	if err != nil {
+		return in, err
+	}
+	in.Vout = int(int32(vout))
+	in.Signature, err = r.readVarBytes()
+	if err != nil {
+		return in, err
+	}
+	in.PubKey, err = r.readVarBytes()
+
+	return in, err
+}
@@ -14,8 +14,10 @@ type TXOutput struct {
 
 // Lock signs the output
 func (out *TXOutput) Lock(address []byte) {
-	pubKeyHash := Base58Decode(address)
-	pubKeyHash = pubKeyHash[1 : len(pubKeyHash)-4]
+	pubKeyHash, err := DecodeAddress(string(address))
+	if err != nil {
+		log.Panic(err)
+	}
 	out.PubKeyHash = pubKeyHash
 }
 
@@ -32,9 +34,48 @@ func NewTXOutput(value int, address string) *TXOutput {
 	return txo
 }
 
-// TXOutputs collects TXOutput
+// serialize 编码输出：Value（8字节）、PubKeyHash（varbytes）
+func (out *TXOutput) serialize(buf *bytes.Buffer) {
+	writeUint64(buf, uint64(int64(out.Value)))
+	writeVarBytes(buf, out.PubKeyHash)
+}
+
+// decodeTXOutput 读取一个编码后的输出
+func decodeTXOutput(r *byteReader) (TXOutput, error) {
+	var out TXOutput
+
+	value, err := r.readUint64()
+	if err != nil {
+		return out, err
+	}
+	out.Value = int(int64(value))
+	out.PubKeyHash, err = r.readVarBytes()
+
+	return out, err
+}
+
+// TXOutputs collects the unspent outputs of a transaction, keyed by output index
 type TXOutputs struct {
-	Outputs []TXOutput
+	Outputs    map[int]TXOutput
+	Height     int  //交易所在区块的高度
+	IsCoinbase bool //是否为coinbase交易的输出
+}
+
+// NewTXOutputs collects all outputs of transaction included in the block at height
+func NewTXOutputs(transaction *Transaction, height int) TXOutputs {
+	outs := TXOutputs{make(map[int]TXOutput), height, transaction.IsCoinbase()}
+	for outIdx, out := range transaction.Vout {
+		outs.Outputs[outIdx] = out
+	}
+
+	return outs
+}
+
+// IsMature checks if the outputs can be spent by a transaction in the block at height
+// coinbase的输出要在链上再确认CoinbaseMaturity个区块之后才能花费，
+// 防止链重组后coinbase消失，花费它的交易也跟着失效
+func (outs TXOutputs) IsMature(height int) bool {
+	return !outs.IsCoinbase || height-outs.Height >= activeNetParams.CoinbaseMaturity
 }
 
 // Serialize serializes TXOutputs
@@ -59,6 +100,9 @@ func DeserializeOutputs(data []byte) TXOutputs {
 	if err != nil {
 		log.Panic(err)
 	}
+	if outputs.Outputs == nil {
+		outputs.Outputs = make(map[int]TXOutput)
+	}
 
 	return outputs
 }
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+/**
+未签名交易
+离线签名时交易分三步完成：联网的节点用 createrawtx 从UTXO集中选出输入并生成未签名的交易，
+离线的机器用 signrawtx 签名，签名只需要钱包文件，不需要区块链，最后联网的节点用 sendrawtx 发送交易。
+签名需要每个输入花费的输出的公钥Hash，显示交易费需要它们的金额，所以未签名交易中带着这些输出。
+一笔交易的输入可以属于不同的钱包，每个钱包签名自己的输入，全部签名后交易才完整
+*/
+
+// rawTxMagic 未签名交易编码的开头，用来区分其他数据
+const rawTxMagic = "ptx\xff"
+
+// RawTransaction 是一笔还没有完成签名的交易和它的输入花费的输出
+type RawTransaction struct {
+	Tx    Transaction
+	Spent []TXOutput //Tx.Vin[i] 花费的输出是 Spent[i]
+}
+
+// Payment 是一笔付款的收款地址和金额
+type Payment struct {
+	Address string `json:"address"`
+	Amount  int    `json:"amount"`
+}
+
+// NewRawTransaction 从地址from的未花费输出中选出输入，生成一笔向to转账amount的未签名交易，
+// 找零回到from。from可以是只观察地址
+func NewRawTransaction(from, to string, amount, fee int, UTXOSet *UTXOSet) (*RawTransaction, error) {
+	return NewRawTransactionToMany(from, []Payment{{to, amount}}, fee, nil, UTXOSet)
+}
+
+// NewRawTransactionToMany 生成一笔向多个地址付款的未签名交易，每笔付款一个输出，按 payments 的顺序排列，
+// 找零是最后一个输出。coinControl 决定花费哪些输出，为nil时使用默认的选币策略
+func NewRawTransactionToMany(from string, payments []Payment, fee int, coinControl *CoinControl, UTXOSet *UTXOSet) (*RawTransaction, error) {
+	pubKeyHash, err := DecodeAddress(from)
+	if err != nil {
+		return nil, err
+	}
+	if len(payments) == 0 {
+		return nil, errors.New("no payments")
+	}
+
+	total := fee
+	for _, payment := range payments {
+		if !ValidateAddress(payment.Address) {
+			return nil, fmt.Errorf("recipient address %s is not valid", payment.Address)
+		}
+		if payment.Amount <= 0 || total+payment.Amount < total {
+			return nil, fmt.Errorf("invalid amount %d for %s", payment.Amount, payment.Address)
+		}
+		total += payment.Amount
+	}
+
+	coins, err := coinControl.selectCoins(UTXOSet.FindSpendableCoins(pubKeyHash), total)
+	if err != nil {
+		return nil, err
+	}
+	//按输出的位置排序，同样的输出总是生成同样的交易
+	sort.Slice(coins, func(i, j int) bool {
+		if c := bytes.Compare(coins[i].Txid, coins[j].Txid); c != 0 {
+			return c < 0
+		}
+		return coins[i].Vout < coins[j].Vout
+	})
+
+	rtx := &RawTransaction{}
+	acc := 0
+	for _, coin := range coins {
+		rtx.Tx.Vin = append(rtx.Tx.Vin, TXInput{coin.Txid, coin.Vout, nil, nil})
+		rtx.Spent = append(rtx.Spent, coin.Output)
+		acc += coin.Output.Value
+	}
+
+	for _, payment := range payments {
+		rtx.Tx.Vout = append(rtx.Tx.Vout, *NewTXOutput(payment.Amount, payment.Address))
+	}
+	if acc > total {
+		rtx.Tx.Vout = append(rtx.Tx.Vout, *NewTXOutput(acc-total, from)) // a change
+	}
+	rtx.Tx.ID = rtx.Tx.unsignedHash()
+
+	return rtx, nil
+}
+
+// Sign 用钱包的私钥签名所有属于它且还没有签名的输入，返回签名的输入个数
+func (rtx *RawTransaction) Sign(wallet *Wallet) int {
+	pubKeyHash := HashPubKey(wallet.PublicKey)
+	signed := 0
+
+	for inID, vin := range rtx.Tx.Vin {
+		if len(vin.Signature) > 0 || !bytes.Equal(rtx.Spent[inID].PubKeyHash, pubKeyHash) {
+			continue
+		}
+
+		rtx.Tx.Vin[inID].PubKey = wallet.PublicKey
+		rtx.Tx.signInput(inID, wallet.PrivateKey, rtx.Spent)
+		signed++
+	}
+	//交易ID包含输入的公钥，签名后重新计算
+	rtx.Tx.ID = rtx.Tx.unsignedHash()
+
+	return signed
+}
+
+// SignedInputs returns the number of inputs that carry a signature
+func (rtx *RawTransaction) SignedInputs() int {
+	signed := 0
+
+	for _, vin := range rtx.Tx.Vin {
+		if len(vin.Signature) > 0 {
+			signed++
+		}
+	}
+
+	return signed
+}
+
+// IsComplete 所有输入都已经签名并且签名正确
+func (rtx *RawTransaction) IsComplete() bool {
+	return rtx.SignedInputs() == len(rtx.Tx.Vin) && rtx.Tx.verifyInputs(rtx.Spent)
+}
+
+// Fee 返回输入总额减去输出总额
+func (rtx *RawTransaction) Fee() int {
+	fee := 0
+
+	for _, out := range rtx.Spent {
+		fee += out.Value
+	}
+	for _, out := range rtx.Tx.Vout {
+		fee -= out.Value
+	}
+
+	return fee
+}
+
+// CheckSpent 检查交易中带的输出和UTXO集中的一致，签名的机器看不到区块链，只能相信这些输出
+func (rtx *RawTransaction) CheckSpent(UTXOSet *UTXOSet) error {
+	for inID, vin := range rtx.Tx.Vin {
+		out, ok := UTXOSet.FindOutput(vin.Txid, vin.Vout)
+		if !ok {
+			return fmt.Errorf("output %x:%d is not in the UTXO set", vin.Txid, vin.Vout)
+		}
+		if out.Value != rtx.Spent[inID].Value || !bytes.Equal(out.PubKeyHash, rtx.Spent[inID].PubKeyHash) {
+			return fmt.Errorf("output %x:%d does not match the UTXO set", vin.Txid, vin.Vout)
+		}
+	}
+
+	return nil
+}
+
+// Serialize 编码为 rawTxMagic、交易、花费的输出个数（varint）、各个输出，交易和输出使用区块的编码格式
+func (rtx *RawTransaction) Serialize() []byte {
+	var buf bytes.Buffer
+
+	buf.WriteString(rawTxMagic)
+	rtx.Tx.serialize(&buf)
+	writeVarInt(&buf, uint64(len(rtx.Spent)))
+	for i := range rtx.Spent {
+		rtx.Spent[i].serialize(&buf)
+	}
+
+	return buf.Bytes()
+}
+
+// DeserializeRawTransaction 解码未签名交易，数据来自其他机器，所以返回错误而不是panic
+func DeserializeRawTransaction(data []byte) (*RawTransaction, error) {
+	r := &byteReader{data: data}
+
+	magic, err := r.read(len(rawTxMagic))
+	if err != nil || string(magic) != rawTxMagic {
+		return nil, errors.New("data is not a raw transaction")
+	}
+
+	rtx := &RawTransaction{}
+	rtx.Tx, err = decodeTransaction(r)
+	if err != nil {
+		return nil, err
+	}
+	if rtx.Tx.IsCoinbase() {
+		return nil, errors.New("raw transaction cannot be a coinbase")
+	}
+
+	count, err := r.readVarInt()
+	if err != nil {
+		return nil, err
+	}
+	if count != uint64(len(rtx.Tx.Vin)) {
+		return nil, errors.New("raw transaction must carry one spent output per input")
+	}
+	for i := uint64(0); i < count; i++ {
+		out, err := decodeTXOutput(r)
+		if err != nil {
+			return nil, err
+		}
+		rtx.Spent = append(rtx.Spent, out)
+	}
+
+	if err := r.done(); err != nil {
+		return nil, err
+	}
+
+	return rtx, nil
+}
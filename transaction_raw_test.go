@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRawTransactionSigning(t *testing.T) {
+	defer func(old *ChainParams) { activeNetParams = old }(activeNetParams)
+	activeNetParams = &RegTestParams
+
+	alice, bob, carol := NewWallet(), NewWallet(), NewWallet()
+	aliceAddress, bobAddress := string(alice.GetAddress()), string(bob.GetAddress())
+	carolAddress := string(carol.GetAddress())
+
+	bc := CreateBlockchainWithStorage(NewMemoryStorage(), aliceAddress)
+	defer bc.db.Close()
+	UTXOSet := UTXOSet{bc}
+	_, err := bc.MineBlock(context.Background(), []*Transaction{NewCoinbaseTX(bobAddress, "", GetBlockSubsidy(1))})
+	assert.Nil(t, err)
+
+	_, err = NewRawTransaction(aliceAddress, carolAddress, GetBlockSubsidy(0), 1, &UTXOSet)
+	assert.NotNil(t, err)
+
+	//alice和bob各出一个输入，每个人只能签名自己的输入
+	rtx, err := NewRawTransaction(aliceAddress, carolAddress, 4, 1, &UTXOSet)
+	assert.Nil(t, err)
+	other, err := NewRawTransaction(bobAddress, carolAddress, 3, 1, &UTXOSet)
+	assert.Nil(t, err)
+	rtx.Tx.Vin = append(rtx.Tx.Vin, other.Tx.Vin...)
+	rtx.Tx.Vout = append(rtx.Tx.Vout, other.Tx.Vout...)
+	rtx.Spent = append(rtx.Spent, other.Spent...)
+	assert.Equal(t, 2, rtx.Fee())
+
+	assert.Equal(t, 0, rtx.Sign(carol))
+	assert.Equal(t, 1, rtx.Sign(alice))
+	assert.False(t, rtx.IsComplete())
+
+	decoded, err := DeserializeRawTransaction(rtx.Serialize())
+	assert.Nil(t, err)
+	assert.Equal(t, rtx.Serialize(), decoded.Serialize())
+	assert.Equal(t, 1, decoded.SignedInputs())
+
+	assert.Equal(t, 1, decoded.Sign(bob))
+	assert.True(t, decoded.IsComplete())
+	assert.Nil(t, decoded.CheckSpent(&UTXOSet))
+	assert.True(t, bc.VerifyTransaction(&decoded.Tx))
+
+	//签名后改动金额会使签名失效
+	decoded.Tx.Vout[0].Value++
+	assert.False(t, decoded.IsComplete())
+	decoded.Tx.Vout[0].Value--
+	assert.True(t, decoded.IsComplete())
+
+	//签名包含被花费输出的金额，谎报输入金额的交易签名无效
+	decoded.Spent[0].Value++
+	assert.False(t, decoded.IsComplete())
+	assert.NotNil(t, decoded.CheckSpent(&UTXOSet))
+
+	_, err = DeserializeRawTransaction(decoded.Tx.Serialize())
+	assert.NotNil(t, err)
+}
+
+func TestRawTransactionToMany(t *testing.T) {
+	defer func(old *ChainParams) { activeNetParams = old }(activeNetParams)
+	activeNetParams = &RegTestParams
+
+	alice := NewWallet()
+	aliceAddress := string(alice.GetAddress())
+	bc := CreateBlockchainWithStorage(NewMemoryStorage(), aliceAddress)
+	defer bc.db.Close()
+	UTXOSet := UTXOSet{bc}
+
+	var payments []Payment
+	for i := 1; i <= 3; i++ {
+		payments = append(payments, Payment{string(NewWallet().GetAddress()), i})
+	}
+	list := fmt.Sprintf("%s:1, %s:2,%s:3", payments[0].Address, payments[1].Address, payments[2].Address)
+	parsed, err := parsePayments(list)
+	assert.Nil(t, err)
+	assert.Equal(t, payments, parsed)
+
+	//每笔付款一个输出，找零在最后
+	rtx, err := NewRawTransactionToMany(aliceAddress, payments, 1, nil, &UTXOSet)
+	assert.Nil(t, err)
+	assert.Equal(t, 4, len(rtx.Tx.Vout))
+	for i, payment := range payments {
+		assert.Equal(t, payment.Amount, rtx.Tx.Vout[i].Value)
+		pubKeyHash, _ := DecodeAddress(payment.Address)
+		assert.True(t, rtx.Tx.Vout[i].IsLockedWithKey(pubKeyHash))
+	}
+	assert.Equal(t, GetBlockSubsidy(0)-7, rtx.Tx.Vout[3].Value)
+	assert.Equal(t, 1, rtx.Sign(alice))
+	assert.True(t, bc.VerifyTransaction(&rtx.Tx))
+
+	_, err = NewRawTransactionToMany(aliceAddress, append(payments, Payment{aliceAddress, 0}), 1, nil, &UTXOSet)
+	assert.NotNil(t, err)
+	_, err = NewRawTransactionToMany(aliceAddress, append(payments, Payment{"invalid", 1}), 1, nil, &UTXOSet)
+	assert.NotNil(t, err)
+	_, err = parsePayments(payments[0].Address)
+	assert.NotNil(t, err)
+}
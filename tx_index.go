@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bytes"
+	"encoding/gob"
+	"log"
+)
+
+const txIndexBucket = "txindex"
+
+// 交易索引是可选的：txindex表存在就表示开启了交易索引。
+// 开启后主链上每笔交易都记录它所在的区块和在区块中的位置，
+// 区块连接到主链时加入索引，从主链断开时删除
+
+// TxLocation 交易在主链上的位置
+type TxLocation struct {
+	BlockHash []byte //交易所在区块的Hash
+	Index     int    //交易在区块中的位置
+}
+
+// Serialize serializes the transaction location
+func (l TxLocation) Serialize() []byte {
+	var result bytes.Buffer
+	encoder := gob.NewEncoder(&result)
+
+	err := encoder.Encode(l)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	return result.Bytes()
+}
+
+// DeserializeTxLocation deserializes a transaction location
+func DeserializeTxLocation(d []byte) TxLocation {
+	var l TxLocation
+
+	decoder := gob.NewDecoder(bytes.NewReader(d))
+	err := decoder.Decode(&l)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	return l
+}
+
+// getTxLocation 在事务内查找交易的位置，交易索引未开启或交易不在主链上时返回false
+func getTxLocation(tx StorageTx, txid []byte) (TxLocation, bool) {
+	b := tx.Bucket([]byte(txIndexBucket))
+	if b == nil {
+		return TxLocation{}, false
+	}
+
+	data := b.Get(txid)
+	if data == nil {
+		return TxLocation{}, false
+	}
+
+	return DeserializeTxLocation(data), true
+}
+
+// indexBlockTransactions 在事务内把区块中的交易加入交易索引，交易索引未开启时什么也不做
+func indexBlockTransactions(tx StorageTx, block *Block) {
+	b := tx.Bucket([]byte(txIndexBucket))
+	if b == nil {
+		return
+	}
+
+	for i, transaction := range block.Transactions {
+		err := b.Put(transaction.ID, TxLocation{block.Hash, i}.Serialize())
+		if err != nil {
+			log.Panic(err)
+		}
+	}
+}
+
+// unindexBlockTransactions 在事务内从交易索引中删除区块中的交易，交易索引未开启时什么也不做
+func unindexBlockTransactions(tx StorageTx, block *Block) {
+	b := tx.Bucket([]byte(txIndexBucket))
+	if b == nil {
+		return
+	}
+
+	for _, transaction := range block.Transactions {
+		err := b.Delete(transaction.ID)
+		if err != nil {
+			log.Panic(err)
+		}
+	}
+}
+
+// TxIndexEnabled checks if the transaction index is enabled
+func (bc *Blockchain) TxIndexEnabled() bool {
+	enabled := false
+
+	err := bc.db.View(func(tx StorageTx) error {
+		enabled = tx.Bucket([]byte(txIndexBucket)) != nil
+		return nil
+	})
+	if err != nil {
+		log.Panic(err)
+	}
+
+	return enabled
+}
+
+// ReindexTransactions rebuilds the transaction index from the main chain and enables it.
+// It returns the number of indexed transactions
+func (bc *Blockchain) ReindexTransactions() int {
+	count := 0
+
+	err := bc.db.Update(func(tx StorageTx) error {
+		err := tx.DeleteBucket([]byte(txIndexBucket))
+		if err != nil && err != ErrBucketNotFound {
+			log.Panic(err)
+		}
+
+		_, err = tx.CreateBucket([]byte(txIndexBucket))
+		if err != nil {
+			log.Panic(err)
+		}
+
+		b := tx.Bucket([]byte(blocksBucket))
+		for hash := b.Get([]byte("l")); len(hash) > 0; {
+			block := DeserializeBlock(b.Get(hash))
+			indexBlockTransactions(tx, block)
+			count += len(block.Transactions)
+			hash = block.PrevBlockHash
+		}
+
+		return nil
+	})
+	if err != nil {
+		log.Panic(err)
+	}
+
+	return count
+}
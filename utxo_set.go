@@ -1,10 +1,10 @@
 package main
 
 import (
+	"bytes"
 	"encoding/hex"
 	"log"
-
-	"github.com/boltdb/bolt"
+	"sort"
 )
 
 const utxoBucket = "chainstate"
@@ -14,26 +14,58 @@ type UTXOSet struct {
 	Blockchain *Blockchain
 }
 
-// FindSpendableOutputs finds and returns unspent outputs to reference in inputs
-func (u UTXOSet) FindSpendableOutputs(pubkeyHash []byte, amount int) (int, map[string][]int) {
-	unspentOutputs := make(map[string][]int)
-	accumulated := 0
+// FindSpendableCoins returns all unspent outputs of pubkeyHash in the order of the UTXO set
+// 还没有成熟的coinbase输出不能被下一个区块中的交易花费，会被跳过
+func (u UTXOSet) FindSpendableCoins(pubkeyHash []byte) []Coin {
+	var coins []Coin
 	db := u.Blockchain.db
 
-	err := db.View(func(tx *bolt.Tx) error {
+	err := db.View(func(tx StorageTx) error {
+		tip := tx.Bucket([]byte(blocksBucket)).Get([]byte("l"))
+		nextHeight := getBlockIndex(tx, tip).Height + 1
+
 		b := tx.Bucket([]byte(utxoBucket))
 		c := b.Cursor()
 
 		for k, v := c.First(); k != nil; k, v = c.Next() {
-			txID := hex.EncodeToString(k)
 			outs := DeserializeOutputs(v)
+			if !outs.IsMature(nextHeight) {
+				continue
+			}
 
+			//Outputs 是map，按输出序号排序，保证每次顺序相同
+			var indexes []int
 			for outIdx, out := range outs.Outputs {
-				if out.IsLockedWithKey(pubkeyHash) && accumulated < amount {
-					accumulated += out.Value
-					unspentOutputs[txID] = append(unspentOutputs[txID], outIdx)
+				if out.IsLockedWithKey(pubkeyHash) {
+					indexes = append(indexes, outIdx)
 				}
 			}
+			sort.Ints(indexes)
+
+			for _, outIdx := range indexes {
+				txID := append([]byte(nil), k...)
+				coins = append(coins, Coin{Outpoint{txID, outIdx}, outs.Outputs[outIdx]})
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		log.Panic(err)
+	}
+
+	return coins
+}
+
+// FindOutput returns the unspent output vout of transaction txid
+func (u UTXOSet) FindOutput(txid []byte, vout int) (TXOutput, bool) {
+	var out TXOutput
+	found := false
+
+	err := u.Blockchain.db.View(func(tx StorageTx) error {
+		outsBytes := tx.Bucket([]byte(utxoBucket)).Get(txid)
+		if outsBytes != nil {
+			out, found = DeserializeOutputs(outsBytes).Outputs[vout]
 		}
 
 		return nil
@@ -42,7 +74,7 @@ func (u UTXOSet) FindSpendableOutputs(pubkeyHash []byte, amount int) (int, map[s
 		log.Panic(err)
 	}
 
-	return accumulated, unspentOutputs
+	return out, found
 }
 
 // FindUTXO finds UTXO for a public key hash
@@ -50,7 +82,7 @@ func (u UTXOSet) FindUTXO(pubKeyHash []byte) []TXOutput {
 	var UTXOs []TXOutput
 	db := u.Blockchain.db
 
-	err := db.View(func(tx *bolt.Tx) error {
+	err := db.View(func(tx StorageTx) error {
 		b := tx.Bucket([]byte(utxoBucket))
 		c := b.Cursor()
 
@@ -78,7 +110,7 @@ func (u UTXOSet) CountTransactions() int {
 	db := u.Blockchain.db
 	counter := 0
 
-	err := db.View(func(tx *bolt.Tx) error {
+	err := db.View(func(tx StorageTx) error {
 		b := tx.Bucket([]byte(utxoBucket))
 		c := b.Cursor()
 
@@ -100,9 +132,9 @@ func (u UTXOSet) Reindex() {
 	db := u.Blockchain.db
 	bucketName := []byte(utxoBucket)
 
-	err := db.Update(func(tx *bolt.Tx) error {
+	err := db.Update(func(tx StorageTx) error {
 		err := tx.DeleteBucket(bucketName)
-		if err != nil && err != bolt.ErrBucketNotFound {
+		if err != nil && err != ErrBucketNotFound {
 			log.Panic(err)
 		}
 
@@ -119,7 +151,7 @@ func (u UTXOSet) Reindex() {
 
 	UTXO := u.Blockchain.FindUTXO()
 
-	err = db.Update(func(tx *bolt.Tx) error {
+	err = db.Update(func(tx StorageTx) error {
 		b := tx.Bucket(bucketName)
 
 		for txID, outs := range UTXO {
@@ -143,51 +175,136 @@ func (u UTXOSet) Reindex() {
 func (u UTXOSet) Update(block *Block) {
 	db := u.Blockchain.db
 
-	err := db.Update(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte(utxoBucket))
+	err := db.Update(func(tx StorageTx) error {
+		u.connectBlock(tx, block)
+		return nil
+	})
+	if err != nil {
+		log.Panic(err)
+	}
+}
 
-		for _, tx := range block.Transactions {
-			if tx.IsCoinbase() == false {
-				for _, vin := range tx.Vin {
-					updatedOuts := TXOutputs{}
-					outsBytes := b.Get(vin.Txid)
-					outs := DeserializeOutputs(outsBytes)
-
-					for outIdx, out := range outs.Outputs {
-						if outIdx != vin.Vout {
-							updatedOuts.Outputs = append(updatedOuts.Outputs, out)
-						}
-					}
+// Disconnect reverts the changes made by the Block to the UTXO set
+// The Block is considered to be the tip of a blockchain
+func (u UTXOSet) Disconnect(block *Block) {
+	db := u.Blockchain.db
 
-					if len(updatedOuts.Outputs) == 0 {
-						err := b.Delete(vin.Txid)
-						if err != nil {
-							log.Panic(err)
-						}
-					} else {
-						err := b.Put(vin.Txid, updatedOuts.Serialize())
-						if err != nil {
-							log.Panic(err)
-						}
-					}
+	err := db.Update(func(tx StorageTx) error {
+		u.disconnectBlock(tx, block)
+		return nil
+	})
+	if err != nil {
+		log.Panic(err)
+	}
+}
 
+// connectBlock 在事务内把区块应用到UTXO集：删除被花费的输出，加入新的输出，
+// 被花费的输出按顺序记录到撤销数据中
+func (u UTXOSet) connectBlock(tx StorageTx, block *Block) {
+	b := tx.Bucket([]byte(utxoBucket))
+	undo := BlockUndo{}
+
+	for _, transaction := range block.Transactions {
+		if transaction.IsCoinbase() == false {
+			for _, vin := range transaction.Vin {
+				outs := DeserializeOutputs(b.Get(vin.Txid))
+				undo.Spent = append(undo.Spent, SpentOutput{vin.Txid, vin.Vout, outs.Outputs[vin.Vout], outs.Height, outs.IsCoinbase})
+				delete(outs.Outputs, vin.Vout)
+
+				if len(outs.Outputs) == 0 {
+					err := b.Delete(vin.Txid)
+					if err != nil {
+						log.Panic(err)
+					}
+				} else {
+					err := b.Put(vin.Txid, outs.Serialize())
+					if err != nil {
+						log.Panic(err)
+					}
 				}
 			}
+		}
+
+		newOutputs := NewTXOutputs(transaction, block.Height)
+
+		err := b.Put(transaction.ID, newOutputs.Serialize())
+		if err != nil {
+			log.Panic(err)
+		}
+	}
+
+	putBlockUndo(tx, block.Hash, undo)
+}
 
-			newOutputs := TXOutputs{}
-			for _, out := range tx.Vout {
-				newOutputs.Outputs = append(newOutputs.Outputs, out)
+// disconnectBlock 在事务内撤销区块对UTXO集的修改，区块必须是当前UTXO集对应的链顶
+// 交易按逆序处理：先删除交易创建的输出，再用撤销数据把它花费的输出放回去
+func (u UTXOSet) disconnectBlock(tx StorageTx, block *Block) {
+	b := tx.Bucket([]byte(utxoBucket))
+	undo := loadBlockUndo(tx, block)
+	pos := len(undo.Spent)
+
+	for i := len(block.Transactions) - 1; i >= 0; i-- {
+		transaction := block.Transactions[i]
+
+		err := b.Delete(transaction.ID)
+		if err != nil {
+			log.Panic(err)
+		}
+
+		if transaction.IsCoinbase() {
+			continue
+		}
+
+		for j := len(transaction.Vin) - 1; j >= 0; j-- {
+			vin := transaction.Vin[j]
+			pos--
+			if pos < 0 || bytes.Compare(undo.Spent[pos].Txid, vin.Txid) != 0 || undo.Spent[pos].Vout != vin.Vout {
+				log.Panicf("ERROR: Undo data of block %x does not match its inputs", block.Hash)
 			}
 
-			err := b.Put(tx.ID, newOutputs.Serialize())
+			outs := TXOutputs{Outputs: make(map[int]TXOutput)}
+			if outsBytes := b.Get(vin.Txid); outsBytes != nil {
+				outs = DeserializeOutputs(outsBytes)
+			}
+			outs.Outputs[vin.Vout] = undo.Spent[pos].Output
+			outs.Height = undo.Spent[pos].Height
+			outs.IsCoinbase = undo.Spent[pos].IsCoinbase
+
+			err := b.Put(vin.Txid, outs.Serialize())
 			if err != nil {
 				log.Panic(err)
 			}
 		}
+	}
+}
 
-		return nil
-	})
-	if err != nil {
-		log.Panic(err)
+// loadBlockUndo 读取区块的撤销数据，没有撤销数据的旧区块只能从祖先区块中找回被花费的输出
+func loadBlockUndo(tx StorageTx, block *Block) BlockUndo {
+	undo, ok := getBlockUndo(tx, block.Hash)
+	if !ok {
+		undo = undoFromChain(tx, block)
 	}
+
+	return undo
+}
+
+// undoFromChain 沿区块链向前查找被花费的输出，为没有撤销数据的区块构造撤销数据
+func undoFromChain(tx StorageTx, block *Block) BlockUndo {
+	undo := BlockUndo{}
+
+	for _, transaction := range block.Transactions {
+		if transaction.IsCoinbase() {
+			continue
+		}
+
+		for _, vin := range transaction.Vin {
+			prevTx, prevBlock := findTransactionFrom(tx, block, vin.Txid)
+			if prevTx == nil {
+				log.Panicf("ERROR: Previous transaction %x is not found", vin.Txid)
+			}
+			undo.Spent = append(undo.Spent, SpentOutput{vin.Txid, vin.Vout, prevTx.Vout[vin.Vout], prevBlock.Height, prevTx.IsCoinbase()})
+		}
+	}
+
+	return undo
 }
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBlockUndoRoundTrip(t *testing.T) {
+	defer func(old *ChainParams) { activeNetParams = old }(activeNetParams)
+	activeNetParams = &RegTestParams
+
+	alice, carol := NewWallet(), NewWallet()
+	aliceAddress := string(alice.GetAddress())
+	bc := CreateBlockchainWithStorage(NewMemoryStorage(), aliceAddress)
+	defer bc.db.Close()
+	UTXOSet := UTXOSet{bc}
+	genesis, err := bc.GetBlockByHeight(0)
+	assert.Nil(t, err)
+
+	//区块花费父区块和自己前面的交易创建的输出
+	tx1 := NewUTXOTransaction(alice, string(carol.GetAddress()), 4, 1, &UTXOSet)
+	rtx := &RawTransaction{
+		Tx:    Transaction{Vin: []TXInput{{tx1.ID, 1, nil, nil}}, Vout: []TXOutput{*NewTXOutput(5, aliceAddress)}},
+		Spent: []TXOutput{tx1.Vout[1]},
+	}
+	rtx.Sign(alice)
+	before := dumpBucket(bc, utxoBucket)
+	block, _, err := addTestBlock(bc, &genesis, tx1, &rtx.Tx)
+	assert.Nil(t, err)
+	after := dumpBucket(bc, utxoBucket)
+	assert.NotEqual(t, before, after)
+
+	var undo, fromChain BlockUndo
+	bc.db.View(func(tx StorageTx) error {
+		undo, _ = getBlockUndo(tx, block.Hash)
+		fromChain = undoFromChain(tx, block)
+		return nil
+	})
+	assert.Len(t, undo.Spent, 2)
+	assert.Equal(t, undo, fromChain)
+
+	UTXOSet.Disconnect(block)
+	assert.Equal(t, before, dumpBucket(bc, utxoBucket))
+	UTXOSet.Update(block)
+	assert.Equal(t, after, dumpBucket(bc, utxoBucket))
+
+	//没有撤销数据的区块从祖先区块中找回被花费的输出
+	err = bc.db.Update(func(tx StorageTx) error {
+		return tx.Bucket([]byte(undoBucket)).Delete(block.Hash)
+	})
+	assert.Nil(t, err)
+	UTXOSet.Disconnect(block)
+	assert.Equal(t, before, dumpBucket(bc, utxoBucket))
+}
+
+func TestCoinbaseMaturity(t *testing.T) {
+	defer func(old *ChainParams) { activeNetParams = old }(activeNetParams)
+	params := RegTestParams
+	params.CoinbaseMaturity = 3
+	activeNetParams = &params
+
+	bob := NewWallet()
+	bobAddress := string(bob.GetAddress())
+	bc := CreateBlockchainWithStorage(NewMemoryStorage(), string(NewWallet().GetAddress()))
+	defer bc.db.Close()
+	UTXOSet := UTXOSet{bc}
+	tip, err := bc.GetBlockByHeight(0)
+	assert.Nil(t, err)
+
+	coinbase := NewCoinbaseTX(bobAddress, "", GetBlockSubsidy(1))
+	block, _, err := addTestBlock(bc, &tip, coinbase)
+	assert.Nil(t, err)
+	spend := func() *Transaction {
+		rtx := &RawTransaction{
+			Tx:    Transaction{Vin: []TXInput{{coinbase.ID, 0, nil, nil}}, Vout: []TXOutput{{coinbase.Vout[0].Value, []byte("pubKeyHash")}}},
+			Spent: coinbase.Vout,
+		}
+		rtx.Sign(bob)
+		return &rtx.Tx
+	}
+
+	//下一个区块中coinbase只有 CoinbaseMaturity-1 个确认
+	for block.Height < params.CoinbaseMaturity-1 {
+		block, _, err = addTestBlock(bc, block)
+		assert.Nil(t, err)
+	}
+	assert.Empty(t, UTXOSet.FindSpendableCoins(HashPubKey(bob.PublicKey)))
+	_, _, err = addTestBlock(bc, block, spend())
+	assert.IsType(t, &BlockValidationError{}, err)
+
+	//再过一个区块就可以花费了
+	block, _, err = addTestBlock(bc, block)
+	assert.Nil(t, err)
+	assert.Len(t, UTXOSet.FindSpendableCoins(HashPubKey(bob.PublicKey)), 1)
+	_, _, err = addTestBlock(bc, block, spend())
+	assert.Nil(t, err)
+	assert.Empty(t, UTXOSet.FindSpendableCoins(HashPubKey(bob.PublicKey)))
+}
@@ -6,24 +6,50 @@ import (
 	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/sha256"
+	"encoding/gob"
+	"errors"
+	"fmt"
 	"log"
+	"math/big"
+	"strings"
 
 	"golang.org/x/crypto/ripemd160"
 )
 
-const version = byte(0x00)
-const addressChecksumLen = 4
+// coordinateLen P-256上一个坐标或一个签名分量的字节数，公钥和签名都按这个长度定长编码
+const coordinateLen = 32
+
+// 钱包地址的格式
+const (
+	addressTypeBase58 = "base58"
+	addressTypeBech32 = "bech32"
+)
 
 // Wallet stores private and public keys
 type Wallet struct {
-	PrivateKey ecdsa.PrivateKey
-	PublicKey  []byte
+	PrivateKey   ecdsa.PrivateKey //钱包加密且没有解锁时为空
+	PublicKey    []byte
+	AddressType  string //GetAddress返回的地址格式，为空时是Base58
+	EncryptedKey []byte //用主密钥加密的私钥，钱包没有加密时为空
+
+	DerivationPath string //HD钱包中私钥的派生路径，随机生成的私钥为空
+}
+
+// walletData 是钱包保存到文件中的形式。
+// ecdsa.PrivateKey 中的曲线无法用gob编码，所以私钥只保存标量D，加载时再用公钥还原
+type walletData struct {
+	PrivateKey   []byte //私钥的标量D，钱包加密后不保存
+	EncryptedKey []byte
+	PublicKey    []byte
+	AddressType  string
+
+	DerivationPath string
 }
 
 // NewWallet creates and returns a Wallet
 func NewWallet() *Wallet {
 	private, public := newKeyPair()
-	wallet := Wallet{private, public}
+	wallet := Wallet{PrivateKey: private, PublicKey: public}
 
 	return &wallet
 }
@@ -32,13 +58,109 @@ func NewWallet() *Wallet {
 func (w Wallet) GetAddress() []byte {
 	pubKeyHash := HashPubKey(w.PublicKey)
 
-	versionedPayload := append([]byte{version}, pubKeyHash...)
-	checksum := checksum(versionedPayload)
+	if w.AddressType == addressTypeBech32 {
+		return []byte(encodeBech32Address(pubKeyHash))
+	}
 
-	fullPayload := append(versionedPayload, checksum...)
-	address := Base58Encode(fullPayload)
+	return Base58CheckEncode(activeNetParams.AddressVersion, pubKeyHash)
+}
 
-	return address
+// newWalletFromKey 用私钥的标量创建钱包，公钥由私钥计算
+func newWalletFromKey(d []byte) (*Wallet, error) {
+	curve := elliptic.P256()
+	k := new(big.Int).SetBytes(d)
+	if len(d) != coordinateLen || k.Sign() == 0 || k.Cmp(curve.Params().N) >= 0 {
+		return nil, errors.New("private key is out of range")
+	}
+
+	x, y := curve.ScalarBaseMult(d)
+	wallet := &Wallet{PublicKey: append(padBytes(x.Bytes(), coordinateLen), padBytes(y.Bytes(), coordinateLen)...)}
+
+	return wallet, wallet.setPrivateKey(d)
+}
+
+// EncodePrivateKey 把私钥编码为当前网络的 Base58Check 字符串，格式为 版本号 + 32字节的私钥标量 + 校验和
+func EncodePrivateKey(key *ecdsa.PrivateKey) string {
+	return string(Base58CheckEncode(activeNetParams.PrivateKeyVersion, padBytes(key.D.Bytes(), coordinateLen)))
+}
+
+// DecodePrivateKey 解码 EncodePrivateKey 编码的私钥并返回对应的钱包
+func DecodePrivateKey(encoded string) (*Wallet, error) {
+	version, d, err := Base58CheckDecode([]byte(encoded))
+	if err != nil {
+		return nil, err
+	}
+	if version != activeNetParams.PrivateKeyVersion {
+		return nil, fmt.Errorf("private key version %#x is not valid on %s", version, activeNetParams.Name)
+	}
+
+	return newWalletFromKey(d)
+}
+
+// GobEncode 实现 gob.GobEncoder，钱包加密后只保存私钥的密文
+func (w *Wallet) GobEncode() ([]byte, error) {
+	data := walletData{EncryptedKey: w.EncryptedKey, PublicKey: w.PublicKey, AddressType: w.AddressType, DerivationPath: w.DerivationPath}
+	if len(w.EncryptedKey) == 0 && w.PrivateKey.D != nil {
+		data.PrivateKey = padBytes(w.PrivateKey.D.Bytes(), coordinateLen)
+	}
+
+	var buf bytes.Buffer
+	err := gob.NewEncoder(&buf).Encode(data)
+
+	return buf.Bytes(), err
+}
+
+// GobDecode 实现 gob.GobDecoder
+func (w *Wallet) GobDecode(b []byte) error {
+	var data walletData
+
+	err := gob.NewDecoder(bytes.NewReader(b)).Decode(&data)
+	if err != nil {
+		return err
+	}
+
+	w.PublicKey = data.PublicKey
+	w.AddressType = data.AddressType
+	w.EncryptedKey = data.EncryptedKey
+	w.DerivationPath = data.DerivationPath
+	if len(data.PrivateKey) > 0 {
+		return w.setPrivateKey(data.PrivateKey)
+	}
+
+	return nil
+}
+
+// setPrivateKey 用私钥的标量D和钱包的公钥还原私钥
+func (w *Wallet) setPrivateKey(d []byte) error {
+	if len(w.PublicKey) != 2*coordinateLen {
+		return errors.New("wallet public key must be 64 bytes")
+	}
+
+	curve := elliptic.P256()
+	x := new(big.Int).SetBytes(w.PublicKey[:coordinateLen])
+	y := new(big.Int).SetBytes(w.PublicKey[coordinateLen:])
+	w.PrivateKey = ecdsa.PrivateKey{PublicKey: ecdsa.PublicKey{Curve: curve, X: x, Y: y}, D: new(big.Int).SetBytes(d)}
+
+	return nil
+}
+
+// encrypt 用主密钥加密私钥，加密后私钥只保存在内存中
+func (w *Wallet) encrypt(masterKey []byte) error {
+	var err error
+
+	w.EncryptedKey, err = sealData(masterKey, padBytes(w.PrivateKey.D.Bytes(), coordinateLen), w.PublicKey)
+
+	return err
+}
+
+// decrypt 用主密钥解密私钥
+func (w *Wallet) decrypt(masterKey []byte) error {
+	d, err := openData(masterKey, w.EncryptedKey, w.PublicKey)
+	if err != nil {
+		return err
+	}
+
+	return w.setPrivateKey(d)
 }
 
 // HashPubKey hashes public key
@@ -57,21 +179,49 @@ func HashPubKey(pubKey []byte) []byte {
 
 // ValidateAddress check if Address if valid
 func ValidateAddress(address string) bool {
-	pubKeyHash := Base58Decode([]byte(address))
-	actualChecksum := pubKeyHash[len(pubKeyHash)-addressChecksumLen:]
-	version := pubKeyHash[0]
-	pubKeyHash = pubKeyHash[1 : len(pubKeyHash)-addressChecksumLen]
-	targetChecksum := checksum(append([]byte{version}, pubKeyHash...))
+	_, err := DecodeAddress(address)
 
-	return bytes.Compare(actualChecksum, targetChecksum) == 0
+	return err == nil
 }
 
-// Checksum generates a checksum for a public key
-func checksum(payload []byte) []byte {
-	firstSHA := sha256.Sum256(payload)
-	secondSHA := sha256.Sum256(firstSHA[:])
+// DecodeAddress 解码地址并返回其中的公钥Hash。
+// 以当前网络Bech32前缀开头的地址按Bech32解码，其他地址按Base58Check解码，版本号必须是当前网络的地址版本号
+func DecodeAddress(address string) ([]byte, error) {
+	if isBech32Address(address) {
+		pubKeyHash, err := decodeBech32Address(address)
+		if err == nil && len(pubKeyHash) != ripemd160.Size {
+			err = fmt.Errorf("address payload must be %d bytes, got %d", ripemd160.Size, len(pubKeyHash))
+		}
+
+		return pubKeyHash, err
+	}
 
-	return secondSHA[:addressChecksumLen]
+	version, pubKeyHash, err := Base58CheckDecode([]byte(address))
+	if err != nil {
+		return nil, err
+	}
+	if version != activeNetParams.AddressVersion {
+		return nil, fmt.Errorf("address version %#x is not valid on %s", version, activeNetParams.Name)
+	}
+	if len(pubKeyHash) != ripemd160.Size {
+		return nil, fmt.Errorf("address payload must be %d bytes, got %d", ripemd160.Size, len(pubKeyHash))
+	}
+
+	return pubKeyHash, nil
+}
+
+// isBech32Address reports whether the address uses the Bech32 format of the current network
+func isBech32Address(address string) bool {
+	return strings.HasPrefix(strings.ToLower(address), activeNetParams.Bech32HRP+"1")
+}
+
+// normalizeAddress 返回地址在钱包中保存的形式：Bech32地址不区分大小写，统一为小写，Base58地址区分大小写，保持不变
+func normalizeAddress(address string) string {
+	if isBech32Address(address) {
+		return strings.ToLower(address)
+	}
+
+	return address
 }
 
 func newKeyPair() (ecdsa.PrivateKey, []byte) {
@@ -80,7 +230,16 @@ func newKeyPair() (ecdsa.PrivateKey, []byte) {
 	if err != nil {
 		log.Panic(err)
 	}
-	pubKey := append(private.PublicKey.X.Bytes(), private.PublicKey.Y.Bytes()...)
+	pubKey := append(padBytes(private.PublicKey.X.Bytes(), coordinateLen), padBytes(private.PublicKey.Y.Bytes(), coordinateLen)...)
 
 	return *private, pubKey
 }
+
+// padBytes 在大端序整数的前面补0，使它的长度为size
+func padBytes(b []byte, size int) []byte {
+	if len(b) >= size {
+		return b
+	}
+
+	return append(make([]byte, size-len(b)), b...)
+}
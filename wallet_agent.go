@@ -0,0 +1,185 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+/**
+钱包解锁代理
+每个命令都是一个单独的进程，walletpassphrase 验证口令后启动一个后台的代理进程，解锁后的主密钥只保存在代理进程的内存中，
+代理通过网络目录中的unix socket把主密钥交给之后的命令，socket文件只有当前用户可以访问。
+超时或者执行 walletlock 后代理退出，钱包重新锁定。主密钥不会写入磁盘，口令也不会出现在命令行参数中
+*/
+
+const walletAgentSocket = "wallet.agent"
+const walletAgentCommand = "walletagent" //启动代理进程的内部命令，不在帮助中显示
+
+// 代理收到的请求，每个连接一个字节
+const (
+	agentGetKey = 'k' //返回主密钥
+	agentLock   = 'l' //退出代理，锁定钱包
+)
+
+func walletAgentPath() string {
+	return filepath.Join(networkDir(), walletAgentSocket)
+}
+
+// startWalletAgent 启动后台的代理进程，主密钥通过管道交给它，代理开始监听后返回
+func startWalletAgent(masterKey []byte, timeout int) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+
+	cmd := exec.Command(exe, walletAgentCommand, "-datadir", dataDir, "-network", activeNetParams.Name,
+		"-timeout", strconv.Itoa(timeout))
+	detachProcess(cmd)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+
+	err = cmd.Start()
+	if err != nil {
+		return err
+	}
+	_, err = stdin.Write(masterKey)
+	stdin.Close()
+	if err != nil {
+		return err
+	}
+
+	//代理开始监听后输出一行，之后不再使用标准输出
+	line, _ := bufio.NewReader(stdout).ReadString('\n')
+	if line != "ready\n" {
+		cmd.Wait()
+		return errors.New("the wallet agent did not start")
+	}
+
+	return cmd.Process.Release()
+}
+
+// runWalletAgent 是代理进程的入口，从标准输入读取主密钥，提供服务直到超时或者被锁定
+func runWalletAgent(timeout int) error {
+	masterKey, err := ioutil.ReadAll(os.Stdin)
+	if err != nil {
+		return err
+	}
+
+	listener, err := listenWalletAgent()
+	if err != nil {
+		return err
+	}
+	os.Stdout.WriteString("ready\n")
+	os.Stdout.Close()
+
+	serveWalletAgent(listener, masterKey, time.Duration(timeout)*time.Second)
+
+	return nil
+}
+
+// listenWalletAgent 创建代理的socket。先在临时路径上监听，修改权限后再改名，
+// 其他用户在任何时刻都无法连接
+func listenWalletAgent() (*net.UnixListener, error) {
+	path := walletAgentPath()
+	tmpPath := path + ".tmp"
+	os.Remove(tmpPath)
+
+	listener, err := net.ListenUnix("unix", &net.UnixAddr{Name: tmpPath, Net: "unix"})
+	if err != nil {
+		return nil, err
+	}
+	listener.SetUnlinkOnClose(false)
+
+	err = os.Chmod(tmpPath, 0600)
+	if err == nil {
+		err = os.Rename(tmpPath, path)
+	}
+	if err != nil {
+		listener.Close()
+		os.Remove(tmpPath)
+		return nil, err
+	}
+
+	return listener, nil
+}
+
+// serveWalletAgent 回答请求直到超时或者收到锁定请求，退出前删除socket并清除内存中的主密钥
+func serveWalletAgent(listener *net.UnixListener, masterKey []byte, timeout time.Duration) {
+	timer := time.AfterFunc(timeout, func() { listener.Close() })
+	defer timer.Stop()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			break
+		}
+
+		request := make([]byte, 1)
+		conn.SetDeadline(time.Now().Add(time.Second))
+		_, err = conn.Read(request)
+		if err == nil && request[0] == agentGetKey {
+			conn.Write(masterKey)
+		}
+		conn.Close()
+
+		if err == nil && request[0] == agentLock {
+			listener.Close()
+		}
+	}
+
+	os.Remove(walletAgentPath())
+	for i := range masterKey {
+		masterKey[i] = 0
+	}
+}
+
+// requestWalletAgent 向代理发送一个请求，返回代理的回答。没有运行的代理时返回错误
+func requestWalletAgent(request byte) ([]byte, error) {
+	conn, err := net.DialTimeout("unix", walletAgentPath(), time.Second)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	conn.SetDeadline(time.Now().Add(time.Second))
+	_, err = conn.Write([]byte{request})
+	if err != nil {
+		return nil, err
+	}
+
+	var reply bytes.Buffer
+	_, err = reply.ReadFrom(conn)
+
+	return reply.Bytes(), err
+}
+
+// fetchAgentKey 从代理取得解锁后的主密钥，钱包没有解锁时返回nil
+func fetchAgentKey() []byte {
+	masterKey, err := requestWalletAgent(agentGetKey)
+	if err != nil || len(masterKey) != scryptKeyLen {
+		return nil
+	}
+
+	return masterKey
+}
+
+// lockWalletAgent 让正在运行的代理退出，返回是否有代理在运行
+func lockWalletAgent() bool {
+	_, err := requestWalletAgent(agentLock)
+
+	return err == nil
+}
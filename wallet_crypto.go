@@ -0,0 +1,132 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"io"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+/**
+钱包加密
+加密钱包时随机生成一个32字节的主密钥，每个私钥都用主密钥以 AES-256-GCM 加密，
+主密钥再用口令经过 scrypt 派生出的密钥加密后保存在钱包文件中。
+修改口令只需要重新加密主密钥，公钥和地址不加密，钱包锁定时也可以列出地址
+*/
+
+// scrypt 的参数，N=2^15 时在普通机器上派生一次密钥大约需要 100ms
+const (
+	scryptN      = 1 << 15
+	scryptR      = 8
+	scryptP      = 1
+	scryptKeyLen = 32
+	saltLen      = 16
+)
+
+// ErrWrongPassphrase 表示口令错误，无法解密主密钥
+var ErrWrongPassphrase = errors.New("the wallet passphrase entered was incorrect")
+
+// MasterKey 是用口令加密后的主密钥
+type MasterKey struct {
+	Salt       []byte //scrypt 的盐
+	N, R, P    int    //scrypt 的参数
+	Ciphertext []byte //nonce + 加密后的主密钥
+}
+
+// newMasterKey 随机生成一个主密钥，并用口令加密
+func newMasterKey(passphrase string) ([]byte, *MasterKey, error) {
+	key := make([]byte, scryptKeyLen)
+	_, err := io.ReadFull(rand.Reader, key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	mk, err := encryptMasterKey(key, passphrase)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return key, mk, nil
+}
+
+// encryptMasterKey 用口令加密主密钥，每次加密都使用新的盐
+func encryptMasterKey(key []byte, passphrase string) (*MasterKey, error) {
+	mk := &MasterKey{Salt: make([]byte, saltLen), N: scryptN, R: scryptR, P: scryptP}
+	_, err := io.ReadFull(rand.Reader, mk.Salt)
+	if err != nil {
+		return nil, err
+	}
+
+	passKey, err := mk.deriveKey(passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	mk.Ciphertext, err = sealData(passKey, key, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return mk, nil
+}
+
+// Decrypt 用口令解密主密钥，口令错误时返回 ErrWrongPassphrase
+func (mk *MasterKey) Decrypt(passphrase string) ([]byte, error) {
+	passKey, err := mk.deriveKey(passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := openData(passKey, mk.Ciphertext, nil)
+	if err != nil {
+		return nil, ErrWrongPassphrase
+	}
+
+	return key, nil
+}
+
+func (mk *MasterKey) deriveKey(passphrase string) ([]byte, error) {
+	return scrypt.Key([]byte(passphrase), mk.Salt, mk.N, mk.R, mk.P, scryptKeyLen)
+}
+
+// sealData 用 AES-256-GCM 加密数据，返回 nonce + 密文。
+// additionalData 不加密但参与认证，用来把私钥的密文和它的公钥绑定在一起
+func sealData(key, plaintext, additionalData []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	_, err = io.ReadFull(rand.Reader, nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	return gcm.Seal(nonce, nonce, plaintext, additionalData), nil
+}
+
+// openData 解密 sealData 加密的数据，密钥错误或数据被修改时返回错误
+func openData(key, data, additionalData []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < gcm.NonceSize() {
+		return nil, errors.New("ciphertext is too short")
+	}
+
+	return gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], additionalData)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"bytes"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/binary"
+	"encoding/gob"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/tyler-smith/go-bip39"
+)
+
+/**
+分层确定性（HD）钱包
+助记词（BIP39）生成种子，种子按 SLIP-0010 派生出P-256曲线上的私钥，SLIP-0010 就是把 BIP32 的派生算法用到其他曲线上。
+地址的派生路径为 m/44'/币种'/0'/0/序号，币种由网络参数决定，所以只要备份一次助记词就可以恢复所有地址。
+恢复钱包时从序号0开始派生地址，连续 hdGapLimit 个地址都没有交易时停止
+*/
+
+// hdHardened 序号大于等于它的子密钥是硬化派生的，路径中写作 i'
+const hdHardened = 0x80000000
+
+// hdSeedKey SLIP-0010 中 NIST P-256 曲线主密钥的 HMAC 密钥
+const hdSeedKey = "Nist256p1 seed"
+
+// hdGapLimit 恢复钱包时允许连续出现的未使用地址个数
+const hdGapLimit = 20
+
+// hdEntropyBits 新助记词的熵，128位对应12个单词
+const hdEntropyBits = 128
+
+// hdKey 扩展私钥：私钥加上链码
+type hdKey struct {
+	key       []byte //私钥的标量，32字节
+	chainCode []byte
+}
+
+// newHDMasterKey 由种子生成主密钥
+func newHDMasterKey(seed []byte) *hdKey {
+	n := elliptic.P256().Params().N
+
+	data := seed
+	for {
+		mac := hmac.New(sha512.New, []byte(hdSeedKey))
+		mac.Write(data)
+		I := mac.Sum(nil)
+
+		//私钥必须在 [1, n-1] 之间，否则用 I 作为数据重新计算
+		k := new(big.Int).SetBytes(I[:32])
+		if k.Sign() != 0 && k.Cmp(n) < 0 {
+			return &hdKey{I[:32], I[32:]}
+		}
+		data = I
+	}
+}
+
+// Child 派生序号为 index 的子私钥
+func (k *hdKey) Child(index uint32) *hdKey {
+	curve := elliptic.P256()
+	n := curve.Params().N
+
+	var data []byte
+	if index >= hdHardened {
+		data = append([]byte{0}, k.key...)
+	} else {
+		x, y := curve.ScalarBaseMult(k.key)
+		data = elliptic.MarshalCompressed(curve, x, y)
+	}
+	data = binary.BigEndian.AppendUint32(data, index)
+
+	for {
+		mac := hmac.New(sha512.New, k.chainCode)
+		mac.Write(data)
+		I := mac.Sum(nil)
+
+		IL := new(big.Int).SetBytes(I[:32])
+		child := new(big.Int).Add(IL, new(big.Int).SetBytes(k.key))
+		child.Mod(child, n)
+		if IL.Cmp(n) < 0 && child.Sign() != 0 {
+			return &hdKey{padBytes(child.Bytes(), coordinateLen), I[32:]}
+		}
+
+		//结果无效时按 SLIP-0010 用 0x01 || IR || index 重新计算
+		data = binary.BigEndian.AppendUint32(append([]byte{1}, I[32:]...), index)
+	}
+}
+
+// Derive 按路径（例如 m/44'/0'/0'/0/1）派生子私钥
+func (k *hdKey) Derive(path string) (*hdKey, error) {
+	indexes, err := parseDerivationPath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, index := range indexes {
+		k = k.Child(index)
+	}
+
+	return k, nil
+}
+
+// parseDerivationPath 解析派生路径，' 或 h 结尾的序号是硬化派生
+func parseDerivationPath(path string) ([]uint32, error) {
+	parts := strings.Split(path, "/")
+	if parts[0] != "m" {
+		return nil, fmt.Errorf("derivation path %q must start with m", path)
+	}
+
+	var indexes []uint32
+	for _, part := range parts[1:] {
+		hardened := strings.HasSuffix(part, "'") || strings.HasSuffix(part, "h")
+		if hardened {
+			part = part[:len(part)-1]
+		}
+
+		index, err := strconv.ParseUint(part, 10, 32)
+		if err != nil || index >= hdHardened {
+			return nil, fmt.Errorf("invalid index %q in derivation path %q", part, path)
+		}
+		if hardened {
+			index += hdHardened
+		}
+		indexes = append(indexes, uint32(index))
+	}
+
+	return indexes, nil
+}
+
+// hdAddressPath 返回当前网络第 index 个收款地址的派生路径
+func hdAddressPath(index int) string {
+	return fmt.Sprintf("m/44'/%d'/0'/0/%d", activeNetParams.HDCoinType, index)
+}
+
+// newMnemonic 生成新的助记词
+func newMnemonic() (string, error) {
+	entropy, err := bip39.NewEntropy(hdEntropyBits)
+	if err != nil {
+		return "", err
+	}
+
+	return bip39.NewMnemonic(entropy)
+}
+
+// mnemonicToSeed 检查助记词的单词和校验和并生成种子
+func mnemonicToSeed(mnemonic string) ([]byte, error) {
+	return bip39.NewSeedWithErrorChecking(strings.Join(strings.Fields(mnemonic), " "), "")
+}
+
+// HDChain 是钱包的HD种子和已经派生的地址个数
+type HDChain struct {
+	Seed          []byte //BIP39种子，钱包加密且没有解锁时为空
+	EncryptedSeed []byte //用主密钥加密的种子，钱包没有加密时为空
+	NextIndex     int    //下一个要派生的地址序号
+}
+
+// hdChainData 是 HDChain 保存到文件中的形式，钱包加密后不保存种子的明文
+type hdChainData struct {
+	Seed          []byte
+	EncryptedSeed []byte
+	NextIndex     int
+}
+
+// GobEncode 实现 gob.GobEncoder
+func (hd *HDChain) GobEncode() ([]byte, error) {
+	data := hdChainData{EncryptedSeed: hd.EncryptedSeed, NextIndex: hd.NextIndex}
+	if len(hd.EncryptedSeed) == 0 {
+		data.Seed = hd.Seed
+	}
+
+	var buf bytes.Buffer
+	err := gob.NewEncoder(&buf).Encode(data)
+
+	return buf.Bytes(), err
+}
+
+// GobDecode 实现 gob.GobDecoder
+func (hd *HDChain) GobDecode(b []byte) error {
+	var data hdChainData
+
+	err := gob.NewDecoder(bytes.NewReader(b)).Decode(&data)
+	if err != nil {
+		return err
+	}
+	*hd = HDChain(data)
+
+	return nil
+}
+
+func (hd *HDChain) encrypt(masterKey []byte) error {
+	var err error
+
+	hd.EncryptedSeed, err = sealData(masterKey, hd.Seed, nil)
+
+	return err
+}
+
+func (hd *HDChain) decrypt(masterKey []byte) error {
+	seed, err := openData(masterKey, hd.EncryptedSeed, nil)
+	if err != nil {
+		return err
+	}
+	hd.Seed = seed
+
+	return nil
+}
+
+// deriveWallet 派生第 index 个地址的钱包
+func (hd *HDChain) deriveWallet(index int, addressType string) (*Wallet, error) {
+	if len(hd.Seed) == 0 {
+		return nil, ErrWalletLocked
+	}
+
+	path := hdAddressPath(index)
+	key, err := newHDMasterKey(hd.Seed).Derive(path)
+	if err != nil {
+		return nil, err
+	}
+
+	wallet, err := newWalletFromKey(key.key)
+	if err != nil {
+		return nil, err
+	}
+	wallet.AddressType = addressType
+	wallet.DerivationPath = path
+
+	return wallet, nil
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// SLIP-0010 中 NIST P-256 曲线的测试向量1
+func TestHDKeyDerivation(t *testing.T) {
+	seed, _ := hex.DecodeString("000102030405060708090a0b0c0d0e0f")
+	master := newHDMasterKey(seed)
+
+	vectors := []struct {
+		path, chainCode, key string
+	}{
+		{"m", "beeb672fe4621673f722f38529c07392fecaa61015c80c34f29ce8b41b3cb6ea", "612091aaa12e22dd2abef664f8a01a82cae99ad7441b7ef8110424915c268bc2"},
+		{"m/0'", "3460cea53e6a6bb5fb391eeef3237ffd8724bf0a40e94943c98b83825342ee11", "6939694369114c67917a182c59ddb8cafc3004e63ca5d3b84403ba8613debc0c"},
+		{"m/0'/1", "4187afff1aafa8445010097fb99d23aee9f599450c7bd140b6826ac22ba21d0c", "284e9d38d07d21e4e281b645089a94f4cf5a5a81369acf151a1c3a57f18b2129"},
+	}
+
+	for _, v := range vectors {
+		key, err := master.Derive(v.path)
+		assert.Nil(t, err)
+		assert.Equal(t, v.chainCode, hex.EncodeToString(key.chainCode), v.path)
+		assert.Equal(t, v.key, hex.EncodeToString(key.key), v.path)
+	}
+
+	_, err := master.Derive("0/1")
+	assert.NotNil(t, err)
+	_, err = master.Derive("m/x")
+	assert.NotNil(t, err)
+}
+
+func TestHDWalletRestore(t *testing.T) {
+	defer func(old string) { dataDir = old }(dataDir)
+	dataDir = t.TempDir()
+
+	mnemonic, err := newMnemonic()
+	assert.Nil(t, err)
+	seed, err := mnemonicToSeed(mnemonic)
+	assert.Nil(t, err)
+
+	wallets, _ := NewWallets()
+	assert.Nil(t, wallets.SetHDSeed(seed))
+	var addresses []string
+	for i := 0; i < 3; i++ {
+		address, err := wallets.CreateWallet(addressTypeBase58)
+		assert.Nil(t, err)
+		addresses = append(addresses, address)
+	}
+	assert.Equal(t, "m/44'/0'/0'/0/2", wallets.WalletMap[addresses[2]].DerivationPath)
+	wallets.SaveToFile()
+
+	//加载后继续派生下一个地址
+	wallets, _ = NewWallets()
+	next, err := wallets.CreateWallet(addressTypeBase58)
+	assert.Nil(t, err)
+	assert.Equal(t, "m/44'/0'/0'/0/3", wallets.WalletMap[next].DerivationPath)
+
+	//只有第2个地址用过时，恢复出序号0到2的地址
+	used, _ := DecodeAddress(addresses[2])
+	restored := &Wallets{WalletMap: make(map[string]*Wallet)}
+	seed, _ = mnemonicToSeed(mnemonic)
+	assert.Nil(t, restored.SetHDSeed(seed))
+	found, err := restored.DiscoverHDWallets(addressTypeBase58, hdGapLimit, func(pubKeyHash []byte) bool {
+		return string(pubKeyHash) == string(used)
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, found)
+	assert.ElementsMatch(t, addresses, restored.GetAddresses())
+	assert.Equal(t, wallets.WalletMap[addresses[1]].PrivateKey.D, restored.WalletMap[addresses[1]].PrivateKey.D)
+	assert.Equal(t, 3, restored.HDChain.NextIndex)
+
+	_, err = mnemonicToSeed("abandon abandon abandon")
+	assert.NotNil(t, err)
+
+	//随机生成的私钥不能用助记词恢复，这样的钱包不能再加HD种子
+	random := &Wallets{WalletMap: make(map[string]*Wallet)}
+	_, err = random.CreateWallet(addressTypeBase58)
+	assert.Nil(t, err)
+	assert.NotNil(t, random.SetHDSeed(seed))
+}
@@ -2,25 +2,35 @@ package main
 
 import (
 	"bytes"
-	"crypto/elliptic"
 	"encoding/gob"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"log"
+	"math/big"
 	"os"
 )
 
 const walletFile = "wallet.dat"
 
+// ErrWalletLocked 表示钱包已加密并且没有解锁，无法使用私钥
+var ErrWalletLocked = errors.New("wallet is locked, unlock it with walletpassphrase first")
+
 // WalletMap stores a collection of wallets
 type Wallets struct {
 	WalletMap map[string]*Wallet
+	MasterKey *MasterKey      //用口令加密的主密钥，钱包没有加密时为nil
+	HDChain   *HDChain        //HD种子，不是HD钱包时为nil
+	WatchOnly map[string]bool //只观察的地址，钱包中没有它们的私钥
+
+	masterKey []byte //解锁后的主密钥，只保存在内存中
 }
 
 // NewWallets creates WalletMap and fills it from a file if it exists
 func NewWallets() (*Wallets, error) {
 	wallets := Wallets{}
 	wallets.WalletMap = make(map[string]*Wallet)
+	wallets.WatchOnly = make(map[string]bool)
 
 	err := wallets.LoadFromFile()
 
@@ -28,13 +38,165 @@ func NewWallets() (*Wallets, error) {
 }
 
 // CreateWallet adds a Wallet to WalletMap
-func (ws *Wallets) CreateWallet() string {
-	wallet := NewWallet()
-	address := fmt.Sprintf("%s", wallet.GetAddress())
+// addressType 是新钱包地址的格式：base58 或 bech32。有HD种子时按顺序派生下一个私钥，否则随机生成。
+// 加密的钱包需要先解锁才能创建新的私钥
+func (ws *Wallets) CreateWallet(addressType string) (string, error) {
+	if ws.IsLocked() {
+		return "", ErrWalletLocked
+	}
+
+	var wallet *Wallet
+	if ws.HDChain != nil {
+		var err error
+		wallet, err = ws.HDChain.deriveWallet(ws.HDChain.NextIndex, addressType)
+		if err != nil {
+			return "", err
+		}
+		ws.HDChain.NextIndex++
+	} else {
+		wallet = NewWallet()
+	}
+
+	return ws.addWallet(wallet, addressType)
+}
+
+// addWallet 把私钥加入钱包，钱包已加密时用主密钥加密私钥
+func (ws *Wallets) addWallet(wallet *Wallet, addressType string) (string, error) {
+	wallet.AddressType = addressType
+	address := normalizeAddress(string(wallet.GetAddress()))
+
+	if ws.IsEncrypted() {
+		err := wallet.encrypt(ws.masterKey)
+		if err != nil {
+			return "", err
+		}
+	}
 
 	ws.WalletMap[address] = wallet
 
-	return address
+	return address, nil
+}
+
+// SetHDSeed 把钱包变为HD钱包，之后创建的私钥都由种子派生。
+// 已经有随机生成的私钥时拒绝，因为这些私钥无法用助记词恢复，HD钱包要在新的钱包文件中创建
+func (ws *Wallets) SetHDSeed(seed []byte) error {
+	if ws.IsLocked() {
+		return ErrWalletLocked
+	}
+	if ws.HDChain != nil {
+		return errors.New("wallet already has an HD seed")
+	}
+	for address, wallet := range ws.WalletMap {
+		if wallet.DerivationPath == "" {
+			return fmt.Errorf("wallet already has the key of %s that cannot be restored from a recovery phrase, "+
+				"create the HD wallet in a new -datadir", address)
+		}
+	}
+
+	hd := &HDChain{Seed: seed}
+	if ws.IsEncrypted() {
+		err := hd.encrypt(ws.masterKey)
+		if err != nil {
+			return err
+		}
+	}
+	ws.HDChain = hd
+
+	return nil
+}
+
+// DiscoverHDWallets 从序号0开始派生地址，直到连续 gapLimit 个地址都没有被使用，
+// 把最后一个使用过的地址及之前的地址都加入钱包，没有使用过的地址时只加入第一个地址。
+// 返回使用过的地址个数
+func (ws *Wallets) DiscoverHDWallets(addressType string, gapLimit int, used func(pubKeyHash []byte) bool) (int, error) {
+	if ws.HDChain == nil {
+		return 0, errors.New("wallet has no HD seed")
+	}
+
+	var wallets []*Wallet
+	found, lastUsed := 0, -1
+	for index := 0; index-lastUsed <= gapLimit; index++ {
+		wallet, err := ws.HDChain.deriveWallet(index, addressType)
+		if err != nil {
+			return 0, err
+		}
+		wallets = append(wallets, wallet)
+
+		if used(HashPubKey(wallet.PublicKey)) {
+			found++
+			lastUsed = index
+		}
+	}
+
+	count := lastUsed + 1
+	if count == 0 {
+		count = 1
+	}
+	for _, wallet := range wallets[:count] {
+		_, err := ws.addWallet(wallet, addressType)
+		if err != nil {
+			return 0, err
+		}
+	}
+	if ws.HDChain.NextIndex < count {
+		ws.HDChain.NextIndex = count
+	}
+
+	return found, nil
+}
+
+// ImportWallet 导入一个私钥，地址原来是只观察地址时改为普通地址
+func (ws *Wallets) ImportWallet(wallet *Wallet, addressType string) (string, error) {
+	if ws.IsLocked() {
+		return "", ErrWalletLocked
+	}
+
+	wallet.AddressType = addressType
+	address := normalizeAddress(string(wallet.GetAddress()))
+	if _, ok := ws.WalletMap[address]; ok {
+		return "", fmt.Errorf("the private key of %s is already in the wallet", address)
+	}
+	delete(ws.WatchOnly, address)
+
+	return ws.addWallet(wallet, addressType)
+}
+
+// ImportAddress 加入一个只观察地址，可以查询它的余额和交易但不能花费
+func (ws *Wallets) ImportAddress(address string) error {
+	if !ValidateAddress(address) {
+		return errors.New("address is not valid")
+	}
+	address = normalizeAddress(address)
+	if _, ok := ws.WalletMap[address]; ok {
+		return fmt.Errorf("the private key of %s is already in the wallet", address)
+	}
+	ws.WatchOnly[address] = true
+
+	return nil
+}
+
+// DumpPrivateKey 返回地址对应私钥的编码，钱包需要先解锁
+func (ws *Wallets) DumpPrivateKey(address string) (string, error) {
+	wallet, ok := ws.WalletMap[normalizeAddress(address)]
+	if !ok {
+		return "", fmt.Errorf("the private key of %s is not in the wallet", address)
+	}
+	if ws.IsLocked() {
+		return "", ErrWalletLocked
+	}
+
+	return EncodePrivateKey(&wallet.PrivateKey), nil
+}
+
+// GetWatchOnlyAddresses returns the watch-only addresses
+func (ws *Wallets) GetWatchOnlyAddresses() []string {
+	var addresses []string
+
+	for address := range ws.WatchOnly {
+		addresses = append(addresses, address)
+	}
+
+	return addresses
 }
 
 // GetAddresses returns an array of addresses stored in the wallet file
@@ -48,39 +210,151 @@ func (ws *Wallets) GetAddresses() []string {
 	return addresses
 }
 
+// HasWallet reports whether the private key of the address is in the wallet
+func (ws *Wallets) HasWallet(address string) bool {
+	_, ok := ws.WalletMap[normalizeAddress(address)]
+
+	return ok
+}
+
 // GetWallet returns a Wallet by its Address
 func (ws Wallets) GetWallet(address string) Wallet {
-	return *ws.WalletMap[address]
+	return *ws.WalletMap[normalizeAddress(address)]
+}
+
+// IsEncrypted reports whether the private keys are encrypted with a passphrase
+func (ws *Wallets) IsEncrypted() bool {
+	return ws.MasterKey != nil
+}
+
+// IsLocked reports whether the wallet is encrypted and not unlocked
+func (ws *Wallets) IsLocked() bool {
+	return ws.IsEncrypted() && ws.masterKey == nil
+}
+
+// Encrypt 用口令加密所有私钥，加密后钱包处于锁定状态
+func (ws *Wallets) Encrypt(passphrase string) error {
+	if ws.IsEncrypted() {
+		return errors.New("wallet is already encrypted, use changepassphrase to change the passphrase")
+	}
+
+	masterKey, mk, err := newMasterKey(passphrase)
+	if err != nil {
+		return err
+	}
+
+	for _, wallet := range ws.WalletMap {
+		err = wallet.encrypt(masterKey)
+		if err != nil {
+			return err
+		}
+	}
+	if ws.HDChain != nil {
+		err = ws.HDChain.encrypt(masterKey)
+		if err != nil {
+			return err
+		}
+	}
+	ws.MasterKey = mk
+
+	return nil
+}
+
+// Unlock 用口令解密所有私钥
+func (ws *Wallets) Unlock(passphrase string) error {
+	if !ws.IsEncrypted() {
+		return errors.New("wallet is not encrypted")
+	}
+
+	masterKey, err := ws.MasterKey.Decrypt(passphrase)
+	if err != nil {
+		return err
+	}
+
+	return ws.unlockWithKey(masterKey)
+}
+
+// unlockWithKey 用主密钥解密所有私钥，主密钥来自口令或者 walletpassphrase 启动的解锁代理
+func (ws *Wallets) unlockWithKey(masterKey []byte) error {
+	for address, wallet := range ws.WalletMap {
+		err := wallet.decrypt(masterKey)
+		if err != nil {
+			return fmt.Errorf("cannot decrypt the key of %s: %v", address, err)
+		}
+	}
+	if ws.HDChain != nil {
+		err := ws.HDChain.decrypt(masterKey)
+		if err != nil {
+			return fmt.Errorf("cannot decrypt the HD seed: %v", err)
+		}
+	}
+	ws.masterKey = masterKey
+
+	return nil
+}
+
+// ChangePassphrase 修改口令，只重新加密主密钥，私钥的密文不变
+func (ws *Wallets) ChangePassphrase(oldPassphrase, newPassphrase string) error {
+	if !ws.IsEncrypted() {
+		return errors.New("wallet is not encrypted, use encryptwallet first")
+	}
+
+	masterKey, err := ws.MasterKey.Decrypt(oldPassphrase)
+	if err != nil {
+		return err
+	}
+
+	mk, err := encryptMasterKey(masterKey, newPassphrase)
+	if err != nil {
+		return err
+	}
+	ws.MasterKey = mk
+
+	return nil
 }
 
 // LoadPeersFromFile loads wallets from the file
 func (ws *Wallets) LoadFromFile() error {
-	if _, err := os.Stat(walletFile); os.IsNotExist(err) {
+	if _, err := os.Stat(walletPath()); os.IsNotExist(err) {
 		return err
 	}
 
-	fileContent, err := ioutil.ReadFile(walletFile)
+	fileContent, err := ioutil.ReadFile(walletPath())
 	if err != nil {
 		log.Panic(err)
 	}
 
 	var wallets Wallets
-	gob.Register(elliptic.P256())
 	decoder := gob.NewDecoder(bytes.NewReader(fileContent))
 	err = decoder.Decode(&wallets)
-	if err != nil {
-		log.Panic(err)
+	legacy := err != nil
+	if legacy {
+		//旧版本的钱包文件直接用gob编码 ecdsa.PrivateKey，转换为当前格式后重新保存
+		wallets.WalletMap, err = decodeLegacyWallets(fileContent)
+		if err != nil {
+			log.Panic(err)
+		}
 	}
 
-	ws.WalletMap = wallets.WalletMap
+	if wallets.WalletMap != nil {
+		ws.WalletMap = wallets.WalletMap
+	}
+	ws.MasterKey = wallets.MasterKey
+	ws.HDChain = wallets.HDChain
+	if wallets.WatchOnly != nil {
+		ws.WatchOnly = wallets.WatchOnly
+	}
+	if legacy {
+		ws.SaveToFile()
+	}
 
 	return nil
 }
 
 // SaveToFile saves wallets to a file
+// 文件只有当前用户可以读写，钱包加密后文件中只有私钥的密文
 func (ws Wallets) SaveToFile() {
 	var content bytes.Buffer
-	gob.Register(elliptic.P256())
 
 	encoder := gob.NewEncoder(&content)
 	err := encoder.Encode(ws)
@@ -88,8 +362,55 @@ func (ws Wallets) SaveToFile() {
 		log.Panic(err)
 	}
 
-	err = ioutil.WriteFile(walletFile, content.Bytes(), 0644)
+	writeFileAtomic(walletPath(), content.Bytes())
+}
+
+// writeFileAtomic 先写临时文件再改名，写入过程中出错不会破坏原来的文件
+func writeFileAtomic(path string, data []byte) {
+	tmp := path + ".tmp"
+
+	err := ioutil.WriteFile(tmp, data, 0600)
 	if err != nil {
 		log.Panic(err)
 	}
+
+	err = os.Rename(tmp, path)
+	if err != nil {
+		log.Panic(err)
+	}
+}
+
+// legacyWallets 是旧版本钱包文件的格式，私钥是gob编码的 ecdsa.PrivateKey，其中的曲线不需要，解码时跳过
+type legacyWallets struct {
+	WalletMap map[string]*struct {
+		PrivateKey struct {
+			D *big.Int
+		}
+	}
+}
+
+// decodeLegacyWallets 解码旧版本的钱包文件，用私钥重新生成钱包，地址都是 Base58 格式
+func decodeLegacyWallets(fileContent []byte) (map[string]*Wallet, error) {
+	var legacy legacyWallets
+
+	err := gob.NewDecoder(bytes.NewReader(fileContent)).Decode(&legacy)
+	if err != nil {
+		return nil, err
+	}
+
+	walletMap := make(map[string]*Wallet)
+	for _, old := range legacy.WalletMap {
+		if old.PrivateKey.D == nil {
+			return nil, errors.New("wallet file has a wallet without private key")
+		}
+
+		wallet, err := newWalletFromKey(padBytes(old.PrivateKey.D.Bytes(), coordinateLen))
+		if err != nil {
+			return nil, err
+		}
+		wallet.AddressType = addressTypeBase58
+		walletMap[string(wallet.GetAddress())] = wallet
+	}
+
+	return walletMap, nil
 }
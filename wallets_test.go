@@ -0,0 +1,193 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"encoding/gob"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEncryptedWallets(t *testing.T) {
+	defer func(old string) { dataDir = old }(dataDir)
+	dataDir = t.TempDir()
+
+	wallets, _ := NewWallets()
+	address, err := wallets.CreateWallet(addressTypeBase58)
+	assert.Nil(t, err)
+	key := wallets.GetWallet(address).PrivateKey.D
+
+	assert.Nil(t, wallets.Encrypt("secret"))
+	wallets.SaveToFile()
+
+	info, err := os.Stat(walletPath())
+	assert.Nil(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	//重新加载后钱包是锁定的，私钥不可用，地址仍然可以列出
+	wallets, err = NewWallets()
+	assert.Nil(t, err)
+	assert.True(t, wallets.IsLocked())
+	assert.Equal(t, []string{address}, wallets.GetAddresses())
+	assert.Nil(t, wallets.GetWallet(address).PrivateKey.D)
+	_, err = wallets.CreateWallet(addressTypeBase58)
+	assert.Equal(t, ErrWalletLocked, err)
+
+	assert.Equal(t, ErrWrongPassphrase, wallets.Unlock("wrong"))
+	assert.Nil(t, wallets.ChangePassphrase("secret", "new secret"))
+	wallets.SaveToFile()
+
+	//解锁只在内存中有效，重新加载后钱包仍然是锁定的，数据目录中也没有其他文件
+	wallets, _ = NewWallets()
+	assert.Equal(t, ErrWrongPassphrase, wallets.Unlock("secret"))
+	assert.Nil(t, wallets.Unlock("new secret"))
+	assert.Equal(t, key, wallets.GetWallet(address).PrivateKey.D)
+	wallets.SaveToFile()
+
+	wallets, _ = NewWallets()
+	assert.True(t, wallets.IsLocked())
+	assert.Nil(t, wallets.GetWallet(address).PrivateKey.D)
+	files, err := os.ReadDir(dataDir)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(files))
+}
+
+func TestWalletAgent(t *testing.T) {
+	defer func(old string) { dataDir = old }(dataDir)
+	dataDir = t.TempDir()
+
+	wallets, _ := NewWallets()
+	address, err := wallets.CreateWallet(addressTypeBase58)
+	assert.Nil(t, err)
+	key := wallets.GetWallet(address).PrivateKey.D
+	assert.Nil(t, wallets.Encrypt("secret"))
+	wallets.SaveToFile()
+	assert.Nil(t, fetchAgentKey())
+
+	wallets, _ = NewWallets()
+	assert.Nil(t, wallets.Unlock("secret"))
+	listener, err := listenWalletAgent()
+	assert.Nil(t, err)
+	info, err := os.Stat(walletAgentPath())
+	assert.Nil(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	done := make(chan bool)
+	go func(masterKey []byte) {
+		serveWalletAgent(listener, masterKey, time.Minute)
+		close(done)
+	}(append([]byte(nil), wallets.masterKey...))
+
+	//代理运行期间其他进程不需要口令就能解锁
+	wallets, _ = NewWallets()
+	masterKey := fetchAgentKey()
+	assert.NotNil(t, masterKey)
+	assert.Nil(t, wallets.unlockWithKey(masterKey))
+	assert.Equal(t, key, wallets.GetWallet(address).PrivateKey.D)
+
+	assert.True(t, lockWalletAgent())
+	<-done
+	assert.Nil(t, fetchAgentKey())
+	assert.False(t, lockWalletAgent())
+	_, err = os.Stat(walletAgentPath())
+	assert.True(t, os.IsNotExist(err))
+
+	//超时后代理自动退出
+	listener, err = listenWalletAgent()
+	assert.Nil(t, err)
+	serveWalletAgent(listener, masterKey, 10*time.Millisecond)
+	assert.Nil(t, fetchAgentKey())
+}
+
+func TestImportPrivateKey(t *testing.T) {
+	defer func(old string) { dataDir = old }(dataDir)
+	dataDir = t.TempDir()
+
+	wallets, _ := NewWallets()
+	address, _ := wallets.CreateWallet(addressTypeBase58)
+	privKey, err := wallets.DumpPrivateKey(address)
+	assert.Nil(t, err)
+
+	//导入到另一个钱包后得到同一个地址和私钥
+	wallet, err := DecodePrivateKey(privKey)
+	assert.Nil(t, err)
+	other := &Wallets{WalletMap: make(map[string]*Wallet), WatchOnly: make(map[string]bool)}
+	assert.Nil(t, other.ImportAddress(address))
+	imported, err := other.ImportWallet(wallet, addressTypeBase58)
+	assert.Nil(t, err)
+	assert.Equal(t, address, imported)
+	assert.Equal(t, wallets.WalletMap[address].PrivateKey.D, other.WalletMap[address].PrivateKey.D)
+	assert.Empty(t, other.GetWatchOnlyAddresses())
+
+	_, err = other.ImportWallet(wallet, addressTypeBase58)
+	assert.NotNil(t, err)
+	assert.NotNil(t, other.ImportAddress(address))
+
+	//只观察地址可以保存和加载，但没有私钥
+	watched := string(NewWallet().GetAddress())
+	assert.Nil(t, wallets.ImportAddress(watched))
+	wallets.SaveToFile()
+	wallets, _ = NewWallets()
+	assert.Equal(t, []string{watched}, wallets.GetWatchOnlyAddresses())
+	_, err = wallets.DumpPrivateKey(watched)
+	assert.NotNil(t, err)
+
+	//其他网络的私钥不能导入
+	defer func(old *ChainParams) { activeNetParams = old }(activeNetParams)
+	activeNetParams = &TestNetParams
+	_, err = DecodePrivateKey(privKey)
+	assert.NotNil(t, err)
+}
+
+func TestBech32AddressCase(t *testing.T) {
+	wallets := &Wallets{WalletMap: make(map[string]*Wallet), WatchOnly: make(map[string]bool)}
+	address, err := wallets.CreateWallet(addressTypeBech32)
+	assert.Nil(t, err)
+
+	//大写的Bech32地址和小写的是同一个地址
+	upper := strings.ToUpper(address)
+	assert.True(t, wallets.HasWallet(upper))
+	assert.Equal(t, wallets.GetWallet(address).PublicKey, wallets.GetWallet(upper).PublicKey)
+	_, err = wallets.DumpPrivateKey(upper)
+	assert.Nil(t, err)
+	assert.NotNil(t, wallets.ImportAddress(upper))
+
+	watched := NewWallet()
+	watched.AddressType = addressTypeBech32
+	assert.Nil(t, wallets.ImportAddress(strings.ToUpper(string(watched.GetAddress()))))
+	assert.Equal(t, []string{string(watched.GetAddress())}, wallets.GetWatchOnlyAddresses())
+}
+
+func TestLegacyWalletFile(t *testing.T) {
+	defer func(old string) { dataDir = old }(dataDir)
+	dataDir = t.TempDir()
+
+	//旧版本的钱包文件中，私钥直接是 ecdsa.PrivateKey
+	type oldWallet struct {
+		PrivateKey ecdsa.PrivateKey
+		PublicKey  []byte
+	}
+	wallet := NewWallet()
+	address := string(wallet.GetAddress())
+	old := struct{ WalletMap map[string]*oldWallet }{map[string]*oldWallet{
+		address: {ecdsa.PrivateKey{D: wallet.PrivateKey.D}, wallet.PublicKey},
+	}}
+	var content bytes.Buffer
+	assert.Nil(t, gob.NewEncoder(&content).Encode(old))
+	assert.Nil(t, os.WriteFile(walletPath(), content.Bytes(), 0600))
+
+	//加载时转换为当前格式并重新保存
+	wallets, err := NewWallets()
+	assert.Nil(t, err)
+	assert.Equal(t, []string{address}, wallets.GetAddresses())
+	assert.Equal(t, wallet.PrivateKey.D, wallets.GetWallet(address).PrivateKey.D)
+
+	var saved Wallets
+	fileContent, _ := os.ReadFile(walletPath())
+	assert.Nil(t, gob.NewDecoder(bytes.NewReader(fileContent)).Decode(&saved))
+	assert.Equal(t, wallet.PublicKey, saved.WalletMap[address].PublicKey)
+}